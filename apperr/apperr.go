@@ -0,0 +1,197 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 支持的错误信息语言
+const (
+	LangZh = "zh"
+	LangEn = "en"
+)
+
+// requestIDKey 请求ID在上下文中的键名，与middleware.RequestIDKey一致
+const requestIDKey = "request_id"
+
+// Code 稳定的错误码，客户端根据错误码处理错误，不依赖错误信息的文字
+type Code string
+
+// Error 应用错误，包含错误码、HTTP状态码和中英文错误信息
+// 预定义的错误是共享的，With、Wrap、WithDetail都返回副本
+type Error struct {
+	Code   Code
+	Status int
+	Detail string // 返回给客户端的补充说明，如校验失败的具体原因
+	Err    error  // 内部原因，只记录日志，不返回给客户端
+
+	zh, en string
+	args   []interface{}
+}
+
+// New 定义一个应用错误，zh和en可以包含格式化占位符，通过With填充
+func New(status int, code Code, zh, en string) *Error {
+	return &Error{Code: code, Status: status, zh: zh, en: en}
+}
+
+// Error 实现error接口，返回中文错误信息和内部原因
+func (e *Error) Error() string {
+	message := e.Message(LangZh)
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Unwrap 返回内部原因
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 错误码和信息模板相同即视为同一个错误，用于errors.Is比较预定义错误的副本
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.zh == e.zh
+}
+
+// Message 返回指定语言的错误信息
+func (e *Error) Message(lang string) string {
+	format := e.zh
+	if lang == LangEn {
+		format = e.en
+	}
+	if len(e.args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, e.args...)
+}
+
+// With 返回填充了信息参数的副本
+func (e *Error) With(args ...interface{}) *Error {
+	copied := *e
+	copied.args = args
+	return &copied
+}
+
+// Wrap 返回带有内部原因的副本
+func (e *Error) Wrap(err error) *Error {
+	copied := *e
+	copied.Err = err
+	return &copied
+}
+
+// WithDetail 返回带有补充说明的副本
+func (e *Error) WithDetail(detail string) *Error {
+	copied := *e
+	copied.Detail = detail
+	return &copied
+}
+
+// From 将任意错误转换为应用错误，非应用错误视为内部错误
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrInternal.Wrap(err)
+}
+
+// Language 根据Accept-Language请求头选择错误信息的语言，按q值优先，默认中文
+func Language(c *gin.Context) string {
+	header := c.GetHeader("Accept-Language")
+	if header == "" {
+		return LangZh
+	}
+
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if (primary == LangZh || primary == LangEn) && q > 0 {
+			candidates = append(candidates, candidate{primary, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return LangZh
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].lang
+}
+
+// Body 返回错误响应的内容，JSON响应和SSE的error事件使用相同的结构
+// error为按Accept-Language选择的错误信息，code为错误码，request_id用于排查日志
+func Body(c *gin.Context, err error) gin.H {
+	e := From(err)
+	body := gin.H{
+		"error": e.Message(Language(c)),
+		"code":  e.Code,
+	}
+	if requestID := c.GetString(requestIDKey); requestID != "" {
+		body["request_id"] = requestID
+	}
+	if e.Detail != "" {
+		body["detail"] = e.Detail
+	}
+	return body
+}
+
+// Respond 写入错误响应，带有内部原因的错误记录到日志
+func Respond(c *gin.Context, err error) {
+	e := From(err)
+	Log(c, e)
+	c.JSON(e.Status, Body(c, e))
+}
+
+// Abort 写入错误响应并停止执行后续的处理函数，用于中间件
+func Abort(c *gin.Context, err error) {
+	Respond(c, err)
+	c.Abort()
+}
+
+// Log 记录错误的内部原因，服务端错误使用Error级别，其他使用Warn级别
+func Log(c *gin.Context, e *Error) {
+	if e.Err == nil {
+		return
+	}
+	level := slog.LevelWarn
+	if e.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	slog.Default().Log(c.Request.Context(), level, e.Message(LangZh),
+		requestIDKey, c.GetString(requestIDKey),
+		"code", e.Code,
+		"error", e.Err,
+	)
+}
+
+// capitalize 将英文信息的首字母大写
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -0,0 +1,172 @@
+package apperr
+
+import "net/http"
+
+// 错误码，新增后不要修改已有的值
+const (
+	CodeInternal           Code = "INTERNAL"
+	CodeInvalidRequest     Code = "INVALID_REQUEST"
+	CodeUnauthorized       Code = "UNAUTHORIZED"
+	CodeAuthMissing        Code = "AUTH_MISSING"
+	CodeAuthInvalid        Code = "AUTH_INVALID"
+	CodeAuthExpired        Code = "AUTH_EXPIRED"
+	CodeInvalidCredentials Code = "INVALID_CREDENTIALS"
+	CodeAdminRequired      Code = "ADMIN_REQUIRED"
+	CodeForbidden          Code = "FORBIDDEN"
+	CodeNotFound           Code = "NOT_FOUND"
+	CodeUsernameTaken      Code = "USERNAME_TAKEN"
+	CodeEmailTaken         Code = "EMAIL_TAKEN"
+	CodeModelRequired      Code = "MODEL_REQUIRED"
+	CodeModelNotAllowed    Code = "MODEL_NOT_ALLOWED"
+	CodeToolNotAllowed     Code = "TOOL_NOT_ALLOWED"
+	CodeQuotaExceeded      Code = "QUOTA_EXCEEDED"
+	CodeInvalidFormat      Code = "INVALID_FORMAT"
+	CodeInvalidTemplate    Code = "INVALID_TEMPLATE"
+	CodeInvalidDocument    Code = "INVALID_DOCUMENT"
+	CodeUnsupportedMedia   Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeUpstreamError      Code = "UPSTREAM_ERROR"
+	CodeUpstreamDown       Code = "UPSTREAM_UNAVAILABLE"
+	CodeUpstreamTimeout    Code = "UPSTREAM_TIMEOUT"
+	CodeModelNotFound      Code = "MODEL_NOT_FOUND"
+	CodeModelOutOfMemory   Code = "MODEL_OUT_OF_MEMORY"
+	CodeContextOverflow    Code = "CONTEXT_OVERFLOW"
+	CodeShuttingDown       Code = "SHUTTING_DOWN"
+)
+
+// 通用错误
+var (
+	ErrInternal       = New(http.StatusInternalServerError, CodeInternal, "服务器内部错误", "Internal server error")
+	ErrInvalidRequest = New(http.StatusBadRequest, CodeInvalidRequest, "无效的请求数据", "Invalid request data")
+)
+
+// 认证和权限错误
+var (
+	ErrUnauthorized       = New(http.StatusUnauthorized, CodeUnauthorized, "未授权", "Unauthorized")
+	ErrTokenMissing       = New(http.StatusUnauthorized, CodeAuthMissing, "未提供认证令牌", "Authentication token is missing")
+	ErrTokenMalformed     = New(http.StatusUnauthorized, CodeAuthInvalid, "认证格式无效", "Malformed authorization header")
+	ErrTokenInvalid       = New(http.StatusUnauthorized, CodeAuthInvalid, "无效的认证令牌", "Invalid authentication token")
+	ErrTokenExpired       = New(http.StatusUnauthorized, CodeAuthExpired, "认证令牌已过期", "Authentication token has expired")
+	ErrInvalidCredentials = New(http.StatusUnauthorized, CodeInvalidCredentials, "用户名或密码错误", "Incorrect username or password")
+	ErrAdminRequired      = New(http.StatusForbidden, CodeAdminRequired, "需要管理员权限", "Administrator privileges required")
+	ErrUsernameTaken      = New(http.StatusBadRequest, CodeUsernameTaken, "用户名已存在", "Username already exists")
+	ErrEmailTaken         = New(http.StatusBadRequest, CodeEmailTaken, "邮箱已被注册", "Email is already registered")
+)
+
+// 聊天请求错误
+var (
+	ErrEmptyMessages          = New(http.StatusBadRequest, CodeInvalidRequest, "消息不能为空", "Messages must not be empty")
+	ErrModelRequired          = New(http.StatusBadRequest, CodeModelRequired, "未指定模型", "No model specified")
+	ErrModelNotAllowed        = New(http.StatusBadRequest, CodeModelNotAllowed, "不允许使用模型: %s", "Model is not allowed: %s")
+	ErrToolNotAllowed         = New(http.StatusBadRequest, CodeToolNotAllowed, "不支持的工具: %s", "Unsupported tool: %s")
+	ErrToolsStreamOnly        = New(http.StatusBadRequest, CodeInvalidRequest, "工具调用仅支持流式聊天", "Tool calling is only supported for streaming chat")
+	ErrTooManyMessages        = New(http.StatusBadRequest, CodeQuotaExceeded, "消息数量超过限制: %d", "Too many messages, the limit is %d")
+	ErrMessageTooLong         = New(http.StatusBadRequest, CodeQuotaExceeded, "单条消息长度超过限制: %d", "Message is too long, the limit is %d characters")
+	ErrFormatRetries          = New(http.StatusBadRequest, CodeInvalidRequest, "format_retries必须在0到%d之间", "format_retries must be between 0 and %d")
+	ErrInvalidFormat          = New(http.StatusBadRequest, CodeInvalidFormat, "无效的输出格式", "Invalid output format")
+	ErrInvalidContextStrategy = New(http.StatusBadRequest, CodeInvalidRequest, "无效的上下文截断策略", "Invalid context strategy")
+	ErrInvalidContextBudget   = New(http.StatusBadRequest, CodeInvalidRequest, "num_ctx过小，没有可用于提示词的上下文长度", "num_ctx is too small to leave any room for the prompt")
+	ErrInlineImages           = New(http.StatusBadRequest, CodeInvalidRequest, "请先上传图片，再通过attachments引用", "Upload images first and reference them via attachments")
+	ErrAttachmentNotText      = New(http.StatusBadRequest, CodeUnsupportedMedia, "附件%s无法作为文本使用", "Attachment %s cannot be used as text")
+	ErrTooFewCompareModels    = New(http.StatusBadRequest, CodeInvalidRequest, "对比至少需要两个不同的模型", "Comparison requires at least two different models")
+	ErrTooManyCompareModels   = New(http.StatusBadRequest, CodeQuotaExceeded, "对比的模型数量超过限制: %d", "Too many models to compare, the limit is %d")
+	ErrUpstream               = New(http.StatusBadGateway, CodeUpstreamError, "模型请求失败", "Model request failed")
+	ErrUpstreamDown           = New(http.StatusServiceUnavailable, CodeUpstreamDown, "模型服务不可用，请稍后重试", "The model service is unavailable, please try again later")
+	ErrUpstreamTimeout        = New(http.StatusGatewayTimeout, CodeUpstreamTimeout, "模型响应超时", "The model timed out")
+	ErrModelNotFound          = New(http.StatusNotFound, CodeModelNotFound, "模型不存在或尚未下载", "The model does not exist or has not been pulled")
+	ErrModelOutOfMemory       = New(http.StatusServiceUnavailable, CodeModelOutOfMemory, "模型服务内存不足，生成已停止", "The model ran out of memory and stopped generating")
+	ErrContextOverflow        = New(http.StatusBadRequest, CodeContextOverflow, "对话内容超过模型的上下文长度", "The conversation exceeds the model's context length")
+	ErrKnowledgeSearch        = New(http.StatusBadGateway, CodeUpstreamError, "检索知识库失败", "Knowledge base search failed")
+	ErrEmbedding              = New(http.StatusBadGateway, CodeUpstreamError, "计算向量失败", "Failed to compute embeddings")
+	ErrListModels             = New(http.StatusInternalServerError, CodeUpstreamError, "获取模型列表失败", "Failed to list models")
+	ErrShuttingDown           = New(http.StatusServiceUnavailable, CodeShuttingDown, "服务正在关闭，生成已中断", "The server is shutting down, generation was interrupted")
+)
+
+// 向量嵌入请求错误
+var (
+	ErrEncodingFormat  = New(http.StatusBadRequest, CodeInvalidRequest, "encoding_format只支持float", "encoding_format only supports float")
+	ErrEmptyInput      = New(http.StatusBadRequest, CodeInvalidRequest, "输入不能为空", "Input must not be empty")
+	ErrEmptyInputItem  = New(http.StatusBadRequest, CodeInvalidRequest, "输入不能包含空字符串", "Input must not contain empty strings")
+	ErrInputType       = New(http.StatusBadRequest, CodeInvalidRequest, "input必须是字符串或字符串数组", "input must be a string or an array of strings")
+	ErrTooManyInputs   = New(http.StatusBadRequest, CodeQuotaExceeded, "输入数量超过限制: %d", "Too many inputs, the limit is %d")
+	ErrInputTooLong    = New(http.StatusBadRequest, CodeQuotaExceeded, "单条输入长度超过限制: %d", "Input is too long, the limit is %d characters")
+	ErrEmbeddingModel  = New(http.StatusBadRequest, CodeModelRequired, "未指定向量模型", "No embedding model specified")
+	ErrInvalidTopK     = New(http.StatusBadRequest, CodeInvalidRequest, "top_k必须在1到%d之间", "top_k must be between 1 and %d")
+	ErrEmbeddingLocked = New(http.StatusBadRequest, CodeInvalidRequest, "知识库的向量模型创建后不可修改", "The embedding model of a knowledge base cannot be changed")
+)
+
+// 文件和文档错误
+var (
+	ErrFileRequired    = New(http.StatusBadRequest, CodeInvalidRequest, "请上传文件", "A file is required")
+	ErrFileTooLarge    = New(http.StatusRequestEntityTooLarge, CodeQuotaExceeded, "文件大小超过限制: %d字节", "File exceeds the size limit of %d bytes")
+	ErrReadFile        = New(http.StatusBadRequest, CodeInvalidRequest, "读取文件失败", "Failed to read the file")
+	ErrUnsupportedType = New(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "不支持的文件类型: %s", "Unsupported file type: %s")
+	ErrInvalidDocument = New(http.StatusBadRequest, CodeInvalidDocument, "无法读取文档内容", "Unable to read the document")
+	ErrEmptyDocument   = New(http.StatusBadRequest, CodeInvalidDocument, "文档中没有可用的文本", "The document contains no usable text")
+)
+
+// 其他资源错误
+var (
+	ErrInvalidTemplate  = New(http.StatusBadRequest, CodeInvalidTemplate, "无效的提示词模板", "Invalid prompt template")
+	ErrRenderTemplate   = New(http.StatusBadRequest, CodeInvalidTemplate, "渲染提示词模板失败", "Failed to render the prompt template")
+	ErrInvalidRating    = New(http.StatusBadRequest, CodeInvalidRequest, "无效的评价: %s", "Invalid rating: %s")
+	ErrCommentTooLong   = New(http.StatusBadRequest, CodeQuotaExceeded, "评价说明长度超过限制: %d", "Feedback comment is too long, the limit is %d characters")
+	ErrFeedbackTarget   = New(http.StatusBadRequest, CodeInvalidRequest, "只能评价AI回复", "Only AI replies can be rated")
+	ErrHistoryIDMissing = New(http.StatusBadRequest, CodeInvalidRequest, "历史记录ID不能为空", "History ID must not be empty")
+	ErrInvalidPage      = New(http.StatusBadRequest, CodeInvalidRequest, "无效的页码", "Invalid page number")
+	ErrPageSize         = New(http.StatusBadRequest, CodeInvalidRequest, "page_size必须在1到%d之间", "page_size must be between 1 and %d")
+	ErrInvalidStartTime = New(http.StatusBadRequest, CodeInvalidRequest, "无效的开始时间", "Invalid start time")
+	ErrInvalidEndTime   = New(http.StatusBadRequest, CodeInvalidRequest, "无效的结束时间", "Invalid end time")
+)
+
+// Resource 接口操作的资源，用于生成“不存在”“无权操作”等错误信息
+type Resource struct {
+	zh, en string
+}
+
+// 资源名称
+var (
+	ResourceUser          = Resource{"用户", "user"}
+	ResourceChatHistory   = Resource{"聊天历史记录", "chat history"}
+	ResourcePreset        = Resource{"提示词预设", "prompt preset"}
+	ResourceTemplate      = Resource{"提示词模板", "prompt template"}
+	ResourceKnowledgeBase = Resource{"知识库", "knowledge base"}
+	ResourceDocument      = Resource{"文档", "document"}
+	ResourceAttachment    = Resource{"附件", "attachment"}
+	ResourceFeedback      = Resource{"评价", "feedback"}
+	ResourceAuditLog      = Resource{"审计日志", "audit log"}
+	ResourceCompareGroup  = Resource{"对比记录", "compare group"}
+	ResourcePreferences   = Resource{"用户偏好", "user preferences"}
+)
+
+// Operation 资源操作，用于生成“保存失败”等错误信息
+type Operation struct {
+	zh, en string
+}
+
+// 资源操作
+var (
+	OpGet    = Operation{"获取", "load"}
+	OpSave   = Operation{"保存", "save"}
+	OpUpdate = Operation{"更新", "update"}
+	OpDelete = Operation{"删除", "delete"}
+)
+
+// NotFound 资源不存在
+func NotFound(r Resource) *Error {
+	return New(http.StatusNotFound, CodeNotFound, r.zh+"不存在", capitalize(r.en)+" not found")
+}
+
+// Forbidden 无权操作属于其他用户的资源
+func Forbidden(r Resource) *Error {
+	return New(http.StatusForbidden, CodeForbidden, "无权操作该"+r.zh, "You do not have permission to access this "+r.en)
+}
+
+// InvalidID 路径或查询参数中的资源ID无效
+func InvalidID(r Resource) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, "无效的"+r.zh+"ID", "Invalid "+r.en+" ID")
+}
+
+// Failed 读写资源失败，err为内部原因
+func Failed(op Operation, r Resource, err error) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, op.zh+r.zh+"失败", "Failed to "+op.en+" "+r.en).Wrap(err)
+}
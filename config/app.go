@@ -0,0 +1,521 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 默认配置文件路径，可以通过CONFIG_FILE环境变量修改
+const defaultConfigFile = "config.yaml"
+
+// Version 服务版本，构建时通过-ldflags "-X github.com/trae-ds-go-backend/config.Version=v1.0.0"设置
+var Version = "dev"
+
+// 开发环境默认JWT密钥，release模式下禁止使用
+const defaultJWTSecret = "default_jwt_secret"
+
+// AppConfig 应用配置
+type AppConfig struct {
+	Server   ServerConfig   `yaml:"server"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Database DatabaseConfig `yaml:"database"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Audit    AuditConfig    `yaml:"audit"`
+	Log      LogConfig      `yaml:"log"`
+	Metrics  MetricsConfig  `yaml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing"`
+	LLM      LLMSettings    `yaml:"llm"`
+}
+
+// ServerConfig 服务器配置
+type ServerConfig struct {
+	Port string `yaml:"port"` // 监听端口
+	Mode string `yaml:"mode"` // Gin运行模式：debug、release、test
+
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // 关闭时等待进行中的请求完成的最长时间
+}
+
+// MetricsConfig 监控指标配置，热加载时不会更新
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"` // 是否暴露/metrics
+	Token   string `yaml:"token"`   // 访问/metrics需要的Bearer令牌，为空时不校验
+	Listen  string `yaml:"listen"`  // 单独的监听地址，如":9090"，为空时与API共用端口
+}
+
+// AuthConfig 认证配置，属于安全相关配置，热加载时不会更新
+type AuthConfig struct {
+	JWTSecret string        `yaml:"jwt_secret"` // JWT签名密钥
+	TokenTTL  time.Duration `yaml:"token_ttl"`  // 令牌有效期
+	Admins    []string      `yaml:"admins"`     // 管理员用户名
+}
+
+// IsAdmin 判断用户名是否为管理员
+func (a AuthConfig) IsAdmin(username string) bool {
+	for _, admin := range a.Admins {
+		if admin == username {
+			return true
+		}
+	}
+	return false
+}
+
+// DatabaseConfig 数据库配置，热加载时不会更新
+type DatabaseConfig struct {
+	Path string `yaml:"path"` // SQLite数据库路径
+}
+
+// StorageConfig 附件存储配置，存储目录热加载时不会更新
+type StorageConfig struct {
+	Dir          string   `yaml:"dir"`           // 附件存储目录
+	MaxSize      int64    `yaml:"max_size"`      // 单个附件的最大字节数
+	AllowedTypes []string `yaml:"allowed_types"` // 允许上传的MIME类型，按文件内容识别
+}
+
+// TypeAllowed 判断MIME类型是否允许上传
+func (s StorageConfig) TypeAllowed(mimeType string) bool {
+	for _, t := range s.AllowedTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// LLMSettings 模型相关配置，热加载时会更新
+type LLMSettings struct {
+	Backends       []Backend         `yaml:"backends"`        // 后端池
+	DefaultModel   string            `yaml:"default_model"`   // 默认模型
+	Models         []string          `yaml:"models"`          // 允许使用的模型，为空表示不限制
+	MaxTokens      int               `yaml:"max_tokens"`      // 默认最大生成token数
+	Temperature    float64           `yaml:"temperature"`     // 默认温度参数
+	Timeout        time.Duration     `yaml:"timeout"`         // 非流式请求和向量请求的超时时间
+	Timeouts       TimeoutSettings   `yaml:"timeouts"`        // 流式请求的连接、首个token和输出间隔超时
+	HealthInterval time.Duration     `yaml:"health_interval"` // 后端健康检查间隔
+	Limits         LimitsConfig      `yaml:"limits"`          // 请求限制
+	Context        ContextSettings   `yaml:"context"`         // 上下文窗口管理
+	Summary        SummarySettings   `yaml:"summary"`         // 长对话滚动摘要
+	RAG            RAGSettings       `yaml:"rag"`             // 知识库检索增强
+	Embeddings     EmbeddingSettings `yaml:"embeddings"`      // 向量嵌入接口
+	Tools          ToolSettings      `yaml:"tools"`           // 工具调用
+
+	ModelConfigs map[string]ModelConfig `yaml:"model_configs"` // 按模型名称配置的默认参数
+}
+
+// LimitsConfig 聊天请求限制
+type LimitsConfig struct {
+	MaxMessages      int `yaml:"max_messages"`       // 单次请求最多消息条数
+	MaxMessageLength int `yaml:"max_message_length"` // 单条消息最大字符数
+	MaxNumPredict    int `yaml:"max_num_predict"`    // 单次生成token数上限，0表示不限制
+	MaxNumCtx        int `yaml:"max_num_ctx"`        // 上下文窗口上限，0表示不限制
+	MaxFormatRetries int `yaml:"max_format_retries"` // 结构化输出校验失败时最多重试次数
+	MaxCompareModels int `yaml:"max_compare_models"` // 对比模式单次请求最多模型数
+}
+
+// DefaultAppConfig 返回默认应用配置
+func DefaultAppConfig() *AppConfig {
+	return &AppConfig{
+		Server: ServerConfig{
+			Port:            "8080",
+			Mode:            "debug",
+			ShutdownTimeout: time.Second * 30,
+		},
+		Auth: AuthConfig{
+			JWTSecret: defaultJWTSecret,
+			TokenTTL:  time.Hour * 24 * 7,
+		},
+		Database: DatabaseConfig{
+			Path: "data.db",
+		},
+		Storage: StorageConfig{
+			Dir:          "uploads",
+			MaxSize:      10 << 20,
+			AllowedTypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp", "text/plain", "application/pdf"},
+		},
+		Audit: AuditConfig{
+			Enabled:      true,
+			StoreContent: true,
+			Retention:    time.Hour * 24 * 90,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterOTLP,
+			ServiceName: "trae-ds-go-backend",
+			SampleRatio: 1,
+		},
+		LLM: LLMSettings{
+			Backends:       []Backend{{Name: "default", URL: DefaultLLMConfig.APIURL, Provider: ProviderOllama}},
+			DefaultModel:   "deepseek-r1:7b",
+			MaxTokens:      DefaultLLMConfig.MaxTokens,
+			Temperature:    DefaultLLMConfig.Temperature,
+			Timeout:        DefaultLLMConfig.Timeout,
+			HealthInterval: defaultHealthInterval,
+			Timeouts: TimeoutSettings{
+				Connect:    defaultConnectTimeout,
+				FirstToken: defaultFirstTokenTimeout,
+				Idle:       defaultIdleTimeout,
+				KeepAlive:  defaultKeepAliveInterval,
+			},
+			Limits: LimitsConfig{
+				MaxMessages:      200,
+				MaxMessageLength: 32000,
+				MaxNumPredict:    8192,
+				MaxNumCtx:        32768,
+				MaxFormatRetries: 3,
+				MaxCompareModels: 4,
+			},
+			Context: ContextSettings{
+				Strategy:      ContextStrategySlidingWindow,
+				DefaultNumCtx: defaultNumCtx,
+			},
+			Summary: SummarySettings{
+				Enabled:    true,
+				Threshold:  20,
+				KeepRecent: 6,
+				MaxTokens:  1024,
+			},
+			RAG: RAGSettings{
+				EmbeddingModel: "nomic-embed-text",
+				ChunkSize:      800,
+				ChunkOverlap:   100,
+				TopK:           4,
+				MaxTopK:        20,
+				MinScore:       0.3,
+				MaxUploadSize:  10 << 20,
+			},
+			Tools: ToolSettings{
+				MaxRounds: 5,
+			},
+		},
+	}
+}
+
+// ModelAllowed 判断模型是否在允许列表中
+func (s LLMSettings) ModelAllowed(model string) bool {
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// metricOtherModel 未配置的模型在监控指标中使用的标签
+const metricOtherModel = "other"
+
+// MetricModel 返回监控指标中使用的模型标签，只有配置中声明过的模型使用原名，
+// 其他模型统一记为other，避免客户端传入任意模型名导致指标基数无限增长
+func (s LLMSettings) MetricModel(model string) string {
+	if len(s.Models) > 0 && s.ModelAllowed(model) {
+		return model
+	}
+	if _, ok := s.ModelConfigs[model]; ok || model == s.DefaultModel {
+		return model
+	}
+	for _, backend := range s.Backends {
+		for _, m := range backend.Models {
+			if m == model {
+				return model
+			}
+		}
+	}
+	return metricOtherModel
+}
+
+// LoadAppConfig 加载配置：默认值 -> 配置文件 -> 环境变量，并进行校验
+// path为空时读取CONFIG_FILE环境变量，默认config.yaml，默认文件不存在时只使用默认值和环境变量
+func LoadAppConfig(path string) (*AppConfig, error) {
+	cfg, err := loadAppConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadAppConfig 加载配置但不校验，热加载时先替换不更新的部分再校验
+func loadAppConfig(path string) (*AppConfig, error) {
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("CONFIG_FILE")
+		explicit = path != ""
+	}
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	cfg := DefaultAppConfig()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件%s失败: %v", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// 默认配置文件不存在时忽略
+	default:
+		return nil, fmt.Errorf("读取配置文件%s失败: %v", path, err)
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv 使用环境变量覆盖配置
+func (cfg *AppConfig) applyEnv() error {
+	if v := os.Getenv("PORT"); v != "" {
+		cfg.Server.Port = v
+	}
+	if v := os.Getenv("GIN_MODE"); v != "" {
+		cfg.Server.Mode = v
+	}
+	if v := os.Getenv("JWT_SECRET"); v != "" {
+		cfg.Auth.JWTSecret = v
+	}
+	// ADMIN_USERS为逗号分隔的用户名
+	if v := os.Getenv("ADMIN_USERS"); v != "" {
+		cfg.Auth.Admins = nil
+		for _, username := range strings.Split(v, ",") {
+			if username = strings.TrimSpace(username); username != "" {
+				cfg.Auth.Admins = append(cfg.Auth.Admins, username)
+			}
+		}
+	}
+	if v := os.Getenv("METRICS_TOKEN"); v != "" {
+		cfg.Metrics.Token = v
+	}
+	if v := os.Getenv("METRICS_LISTEN"); v != "" {
+		cfg.Metrics.Listen = v
+	}
+	if v := os.Getenv("TRACING_EXPORTER"); v != "" {
+		cfg.Tracing.Enabled = true
+		cfg.Tracing.Exporter = v
+	}
+	if v := os.Getenv("TRACING_ENDPOINT"); v != "" {
+		cfg.Tracing.Endpoint = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		cfg.Log.Level = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		cfg.Log.Format = v
+	}
+	if v := os.Getenv("DB_PATH"); v != "" {
+		cfg.Database.Path = v
+	}
+	if v := os.Getenv("UPLOAD_DIR"); v != "" {
+		cfg.Storage.Dir = v
+	}
+
+	// LLM_BACKENDS为JSON数组，优先级高于LLM_API_URL
+	if v := os.Getenv("LLM_BACKENDS"); v != "" {
+		var backends []Backend
+		if err := json.Unmarshal([]byte(v), &backends); err != nil {
+			return fmt.Errorf("解析LLM_BACKENDS失败: %v", err)
+		}
+		cfg.LLM.Backends = backends
+	} else if v := os.Getenv("LLM_API_URL"); v != "" {
+		cfg.LLM.Backends = []Backend{{Name: "default", URL: v, Provider: ProviderOllama}}
+	}
+	return nil
+}
+
+// Validate 校验配置是否合法，同时规范化后端配置
+func (cfg *AppConfig) Validate() error {
+	if port, err := strconv.Atoi(cfg.Server.Port); err != nil || port <= 0 || port > 65535 {
+		return fmt.Errorf("无效的端口: %s", cfg.Server.Port)
+	}
+	switch cfg.Server.Mode {
+	case "debug", "release", "test":
+	default:
+		return fmt.Errorf("无效的运行模式: %s", cfg.Server.Mode)
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		return errors.New("server.shutdown_timeout必须大于0")
+	}
+
+	if cfg.Auth.JWTSecret == "" {
+		return errors.New("JWT密钥不能为空")
+	}
+	if cfg.Server.Mode == "release" && cfg.Auth.JWTSecret == defaultJWTSecret {
+		return errors.New("release模式下必须配置JWT密钥")
+	}
+	if cfg.Auth.TokenTTL <= 0 {
+		return errors.New("令牌有效期必须大于0")
+	}
+
+	if cfg.Database.Path == "" {
+		return errors.New("数据库路径不能为空")
+	}
+	if cfg.Storage.Dir == "" {
+		return errors.New("附件存储目录不能为空")
+	}
+	if cfg.Storage.MaxSize <= 0 {
+		return errors.New("storage.max_size必须大于0")
+	}
+
+	// release模式下与API共用端口的/metrics必须配置令牌
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen == "" && cfg.Metrics.Token == "" && cfg.Server.Mode == "release" {
+		return errors.New("release模式下必须配置metrics.token或metrics.listen")
+	}
+	if err := validateTracingConfig(cfg.Tracing); err != nil {
+		return err
+	}
+	if err := validateLogConfig(cfg.Log); err != nil {
+		return err
+	}
+	if err := validateAuditConfig(&cfg.Audit); err != nil {
+		return err
+	}
+
+	backends, err := NormalizeBackends(cfg.LLM.Backends)
+	if err != nil {
+		return err
+	}
+	cfg.LLM.Backends = backends
+
+	if cfg.LLM.MaxTokens <= 0 {
+		return errors.New("max_tokens必须大于0")
+	}
+	if cfg.LLM.Temperature < 0 || cfg.LLM.Temperature > 2 {
+		return errors.New("temperature必须在0到2之间")
+	}
+	if cfg.LLM.Timeout <= 0 {
+		return errors.New("timeout必须大于0")
+	}
+	if err := validateTimeouts("timeouts", cfg.LLM.Timeouts); err != nil {
+		return err
+	}
+	for model, modelConfig := range cfg.LLM.ModelConfigs {
+		if err := validateTimeouts(fmt.Sprintf("model_configs.%s.timeouts", model), modelConfig.Timeouts); err != nil {
+			return err
+		}
+	}
+	if cfg.LLM.HealthInterval <= 0 {
+		return errors.New("health_interval必须大于0")
+	}
+	if cfg.LLM.DefaultModel != "" && !cfg.LLM.ModelAllowed(cfg.LLM.DefaultModel) {
+		return fmt.Errorf("默认模型%s不在允许的模型列表中", cfg.LLM.DefaultModel)
+	}
+	limits := cfg.LLM.Limits
+	if limits.MaxMessages < 0 || limits.MaxMessageLength < 0 || limits.MaxNumPredict < 0 || limits.MaxNumCtx < 0 || limits.MaxFormatRetries < 0 || limits.MaxCompareModels < 0 {
+		return errors.New("请求限制不能为负数")
+	}
+	if limits.MaxNumPredict > 0 && cfg.LLM.MaxTokens > limits.MaxNumPredict {
+		return errors.New("max_tokens不能超过max_num_predict")
+	}
+	if err := validateContextSettings(cfg.LLM.Context); err != nil {
+		return err
+	}
+	if err := validateSummarySettings(cfg.LLM.Summary); err != nil {
+		return err
+	}
+	if model := cfg.LLM.Summary.Model; model != "" && !cfg.LLM.ModelAllowed(model) {
+		return fmt.Errorf("摘要模型%s不在允许的模型列表中", model)
+	}
+	if err := validateRAGSettings(cfg.LLM.RAG); err != nil {
+		return err
+	}
+	if err := validateToolSettings(cfg.LLM.Tools); err != nil {
+		return err
+	}
+	if model := cfg.LLM.RAG.EmbeddingModel; model != "" && !cfg.LLM.Embeddings.ModelAllowed(model) {
+		return fmt.Errorf("向量模型%s不在允许的向量模型列表中", model)
+	}
+	for model, modelConfig := range cfg.LLM.ModelConfigs {
+		for key := range modelConfig.Options {
+			if alias, ok := optionAliases[key]; ok {
+				key = alias
+			}
+			if !ollamaOptions[key] {
+				return fmt.Errorf("模型%s的参数%s不受支持", model, key)
+			}
+		}
+	}
+	return nil
+}
+
+// Store 保存当前生效的配置，支持热加载
+type Store struct {
+	path     string
+	current  atomic.Pointer[AppConfig]
+	mu       sync.Mutex
+	onReload []func(*AppConfig)
+}
+
+// NewStore 加载配置并创建配置存储
+func NewStore(path string) (*Store, error) {
+	cfg, err := LoadAppConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &Store{path: path}
+	store.current.Store(cfg)
+	return store, nil
+}
+
+// Get 返回当前配置，调用方不应修改返回的配置
+func (s *Store) Get() *AppConfig {
+	return s.current.Load()
+}
+
+// OnReload 注册配置热加载后的回调
+func (s *Store) OnReload(fn func(*AppConfig)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = append(s.onReload, fn)
+}
+
+// Reload 重新加载配置，只更新模型列表、限制等非安全配置
+// 服务器、认证、数据库、监控指标、链路追踪配置、附件存储目录和审计日志配置保持启动时的值，审计日志只更新保留时长
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := loadAppConfig(s.path)
+	if err != nil {
+		return err
+	}
+
+	// 不更新的部分沿用原配置，其中的无效值不应导致热加载失败
+	old := s.Get()
+	cfg.Server = old.Server
+	cfg.Auth = old.Auth
+	cfg.Database = old.Database
+	cfg.Storage.Dir = old.Storage.Dir
+	cfg.Metrics = old.Metrics
+	cfg.Tracing = old.Tracing
+	retention := cfg.Audit.Retention
+	cfg.Audit = old.Audit
+	cfg.Audit.Retention = retention
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s.current.Store(cfg)
+	for _, fn := range s.onReload {
+		fn(cfg)
+	}
+	return nil
+}
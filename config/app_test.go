@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreReloadIgnoresPreservedSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("server:\n  port: \"8080\"\nllm:\n  max_tokens: 1024\n")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	// 热加载不更新服务器配置，其中的无效值不影响其他配置生效
+	write("server:\n  port: \"abc\"\nllm:\n  max_tokens: 2048\n")
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if cfg := store.Get(); cfg.Server.Port != "8080" || cfg.LLM.MaxTokens != 2048 {
+		t.Errorf("Reload()后 port = %s, max_tokens = %d", cfg.Server.Port, cfg.LLM.MaxTokens)
+	}
+
+	// 会更新的配置无效时拒绝热加载，保留原配置
+	write("llm:\n  max_tokens: -1\n")
+	if err := store.Reload(); err == nil {
+		t.Error("max_tokens无效时Reload()应返回错误")
+	}
+	if got := store.Get().LLM.MaxTokens; got != 2048 {
+		t.Errorf("热加载失败后 max_tokens = %d, 期望保持2048", got)
+	}
+}
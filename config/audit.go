@@ -0,0 +1,45 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// redactedText 审计日志中替换敏感内容的文本
+const redactedText = "[REDACTED]"
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Enabled        bool          `yaml:"enabled"`         // 是否记录聊天请求的审计日志
+	StoreContent   bool          `yaml:"store_content"`   // 是否记录提示词和回复内容，关闭时只记录请求哈希
+	RedactPatterns []string      `yaml:"redact_patterns"` // 记录前替换为[REDACTED]的正则表达式
+	Retention      time.Duration `yaml:"retention"`       // 保留时长，0表示永久保留
+
+	redact []*regexp.Regexp
+}
+
+// Redact 按配置的正则表达式替换文本中的敏感内容
+func (a AuditConfig) Redact(text string) string {
+	for _, pattern := range a.redact {
+		text = pattern.ReplaceAllString(text, redactedText)
+	}
+	return text
+}
+
+// validateAuditConfig 校验审计日志配置并编译脱敏规则
+func validateAuditConfig(audit *AuditConfig) error {
+	if audit.Retention < 0 {
+		return errors.New("audit.retention不能为负数")
+	}
+	audit.redact = make([]*regexp.Regexp, 0, len(audit.RedactPatterns))
+	for _, pattern := range audit.RedactPatterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("无效的脱敏规则%s: %v", pattern, err)
+		}
+		audit.redact = append(audit.redact, compiled)
+	}
+	return nil
+}
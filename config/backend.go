@@ -0,0 +1,351 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ProviderOllama Ollama类型的后端
+const ProviderOllama = "ollama"
+
+// 健康检查默认参数
+const (
+	defaultHealthInterval = time.Second * 30
+	defaultHealthTimeout  = time.Second * 5
+)
+
+// Backend 单个LLM后端配置
+type Backend struct {
+	Name     string   `json:"name" yaml:"name"`         // 后端名称，用于日志和状态展示
+	URL      string   `json:"url" yaml:"url"`           // 后端基础地址，例如 http://10.0.0.2:11434
+	Provider string   `json:"provider" yaml:"provider"` // 后端类型，目前支持ollama
+	Models   []string `json:"models" yaml:"models"`     // 该后端提供的模型，为空表示提供全部模型，支持以*结尾的前缀匹配
+}
+
+// ChatURL 返回后端的聊天接口地址
+func (b Backend) ChatURL() string {
+	return b.URL + "/api/chat"
+}
+
+// EmbedURL 返回后端的向量嵌入接口地址
+func (b Backend) EmbedURL() string {
+	return b.URL + "/api/embed"
+}
+
+// TagsURL 返回后端的模型列表接口地址
+func (b Backend) TagsURL() string {
+	return b.URL + "/api/tags"
+}
+
+// Serves 判断后端是否提供指定模型
+func (b Backend) Serves(model string) bool {
+	if len(b.Models) == 0 {
+		return true
+	}
+	for _, m := range b.Models {
+		if m == model {
+			return true
+		}
+		if strings.HasSuffix(m, "*") && strings.HasPrefix(model, strings.TrimSuffix(m, "*")) {
+			return true
+		}
+		// 未指定tag的模型名等价于latest
+		if !strings.Contains(m, ":") && model == m+":latest" {
+			return true
+		}
+	}
+	return false
+}
+
+// BackendStatus 后端健康状态
+type BackendStatus struct {
+	Name      string        `json:"name"`
+	URL       string        `json:"url"`
+	Provider  string        `json:"provider"`
+	Models    []string      `json:"models"`
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency"`
+	LastCheck time.Time     `json:"last_check"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// backendState 后端运行时状态
+type backendState struct {
+	Backend
+	healthy   bool
+	latency   time.Duration
+	lastCheck time.Time
+	lastError string
+}
+
+// BackendPool LLM后端池，负责按模型路由、负载均衡和健康检查
+type BackendPool struct {
+	mu       sync.RWMutex
+	backends []*backendState
+	counter  uint64
+	client   *http.Client
+}
+
+// DefaultPool 全局后端池
+var DefaultPool *BackendPool
+
+// NormalizeBackends 校验后端配置并补全默认值
+func NormalizeBackends(backends []Backend) ([]Backend, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("至少需要配置一个LLM后端")
+	}
+
+	names := make(map[string]bool)
+	normalized := make([]Backend, 0, len(backends))
+	for i, b := range backends {
+		if b.Name == "" {
+			b.Name = fmt.Sprintf("backend-%d", i+1)
+		}
+		if names[b.Name] {
+			return nil, fmt.Errorf("LLM后端名称重复: %s", b.Name)
+		}
+		names[b.Name] = true
+
+		if b.URL == "" {
+			return nil, fmt.Errorf("LLM后端%s未配置地址", b.Name)
+		}
+		b.URL = baseURL(b.URL)
+
+		if b.Provider == "" {
+			b.Provider = ProviderOllama
+		}
+		if b.Provider != ProviderOllama {
+			return nil, fmt.Errorf("LLM后端%s的类型不受支持: %s", b.Name, b.Provider)
+		}
+		normalized = append(normalized, b)
+	}
+	return normalized, nil
+}
+
+// baseURL 去掉地址末尾的接口路径，只保留基础地址
+func baseURL(url string) string {
+	url = strings.TrimSuffix(url, "/")
+	url = strings.TrimSuffix(url, "/api/chat")
+	url = strings.TrimSuffix(url, "/api")
+	return strings.TrimSuffix(url, "/")
+}
+
+// ErrNoBackend 后端池中没有任何后端，通常是后端配置无效
+var ErrNoBackend = errors.New("没有配置LLM后端")
+
+// emptyBackendPool 返回不包含任何后端的后端池，所有模型请求都会返回ErrNoBackend
+func emptyBackendPool() *BackendPool {
+	return &BackendPool{client: &http.Client{Timeout: defaultHealthTimeout}}
+}
+
+// NewBackendPool 创建后端池
+func NewBackendPool(backends []Backend) (*BackendPool, error) {
+	pool := &BackendPool{
+		client: &http.Client{Timeout: defaultHealthTimeout},
+	}
+	if err := pool.Update(backends); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Update 替换后端列表，保留同名后端的健康状态
+func (p *BackendPool) Update(backends []Backend) error {
+	backends, err := NormalizeBackends(backends)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous := make(map[string]*backendState)
+	for _, s := range p.backends {
+		previous[s.Name] = s
+	}
+
+	states := make([]*backendState, 0, len(backends))
+	for _, b := range backends {
+		state := &backendState{Backend: b, healthy: true}
+		if old, ok := previous[b.Name]; ok && old.URL == b.URL {
+			state.healthy = old.healthy
+			state.latency = old.latency
+			state.lastCheck = old.lastCheck
+			state.lastError = old.lastError
+		}
+		states = append(states, state)
+	}
+	p.backends = states
+	return nil
+}
+
+// Candidates 返回提供指定模型的后端，健康的后端按轮询顺序排在前面，不健康的排在最后作为兜底
+func (p *BackendPool) Candidates(model string) []Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var healthy, unhealthy []Backend
+	for _, s := range p.backends {
+		if !s.Serves(model) {
+			continue
+		}
+		if s.healthy {
+			healthy = append(healthy, s.Backend)
+		} else {
+			unhealthy = append(unhealthy, s.Backend)
+		}
+	}
+
+	// 轮询起点，使请求在多个副本之间均匀分布
+	if n := len(healthy); n > 1 {
+		start := int(atomic.AddUint64(&p.counter, 1) % uint64(n))
+		healthy = append(healthy[start:], healthy[:start]...)
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+// Backends 返回全部后端配置
+func (p *BackendPool) Backends() []Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	backends := make([]Backend, 0, len(p.backends))
+	for _, s := range p.backends {
+		backends = append(backends, s.Backend)
+	}
+	return backends
+}
+
+// Status 返回全部后端的健康状态
+func (p *BackendPool) Status() []BackendStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	statuses := make([]BackendStatus, 0, len(p.backends))
+	for _, s := range p.backends {
+		statuses = append(statuses, BackendStatus{
+			Name:      s.Name,
+			URL:       s.URL,
+			Provider:  s.Provider,
+			Models:    s.Models,
+			Healthy:   s.healthy,
+			Latency:   s.latency,
+			LastCheck: s.lastCheck,
+			LastError: s.lastError,
+		})
+	}
+	return statuses
+}
+
+// MarkDown 将后端标记为不健康
+func (p *BackendPool) MarkDown(name string, err error) {
+	p.setHealth(name, false, 0, err)
+}
+
+// setHealth 更新后端健康状态
+func (p *BackendPool) setHealth(name string, healthy bool, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.backends {
+		if s.Name != name {
+			continue
+		}
+		s.healthy = healthy
+		s.latency = latency
+		s.lastCheck = time.Now()
+		s.lastError = ""
+		if err != nil {
+			s.lastError = err.Error()
+		}
+	}
+}
+
+// CheckAll 对全部后端执行一次健康检查
+func (p *BackendPool) CheckAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, b := range p.Backends() {
+		wg.Add(1)
+		go func(b Backend) {
+			defer wg.Done()
+			latency, err := p.check(ctx, b)
+			p.setHealth(b.Name, err == nil, latency, err)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// check 请求后端的模型列表接口判断后端是否可用
+func (p *BackendPool) check(ctx context.Context, b Backend) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.TagsURL(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode != http.StatusOK {
+		return latency, fmt.Errorf("健康检查失败，状态码: %d", resp.StatusCode)
+	}
+	return latency, nil
+}
+
+// StartHealthChecks 启动后台健康检查，ctx取消时停止
+func (p *BackendPool) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+
+	go func() {
+		p.CheckAll(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.CheckAll(ctx)
+			}
+		}
+	}()
+}
+
+// isConnectError 判断错误是否发生在建立连接阶段（此时尚未发送任何数据，可以安全地切换后端）
+func isConnectError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// InitBackendPool 根据配置初始化全局后端池并启动健康检查
+func InitBackendPool(ctx context.Context, settings LLMSettings) error {
+	pool, err := NewBackendPool(settings.Backends)
+	if err != nil {
+		return err
+	}
+	pool.StartHealthChecks(ctx, settings.HealthInterval)
+	DefaultPool = pool
+	return nil
+}
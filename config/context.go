@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// 上下文截断策略
+const (
+	ContextStrategyNone          = "none"           // 不截断
+	ContextStrategySlidingWindow = "sliding_window" // 从最早的消息开始丢弃
+	ContextStrategyDropMiddle    = "drop_middle"    // 保留第一轮对话和最新的消息，丢弃中间的消息
+)
+
+// Ollama未设置num_ctx时的默认上下文窗口
+const defaultNumCtx = 2048
+
+// messageOverhead 每条消息在聊天模板中额外占用的token数
+const messageOverhead = 4
+
+// ErrInvalidBudget 可用于提示词的token数不大于0，通常是num_ctx设置过小
+var ErrInvalidBudget = errors.New("可用于提示词的token数必须大于0")
+
+// ContextSettings 上下文窗口管理配置
+type ContextSettings struct {
+	Strategy      string `yaml:"strategy"`        // 默认截断策略
+	DefaultNumCtx int    `yaml:"default_num_ctx"` // 未配置num_ctx时假定的上下文窗口大小
+}
+
+// ContextReport 上下文截断结果，随响应返回给客户端
+type ContextReport struct {
+	Strategy        string `json:"strategy"`
+	Budget          int    `json:"budget"`           // 可用于提示词的token数
+	EstimatedTokens int    `json:"estimated_tokens"` // 截断后提示词的估算token数
+	Omitted         []int  `json:"omitted"`          // 被省略的消息下标
+	Summarized      int    `json:"summarized"`       // 被对话摘要替换的消息数
+}
+
+// ValidContextStrategy 判断截断策略是否有效
+func ValidContextStrategy(strategy string) bool {
+	switch strategy {
+	case ContextStrategyNone, ContextStrategySlidingWindow, ContextStrategyDropMiddle:
+		return true
+	}
+	return false
+}
+
+// EstimateTokens 估算文本的token数：中日韩字符约每字1个token，其他字符约每4个字符1个token
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// EstimateMessageTokens 估算一条消息的token数
+func EstimateMessageTokens(message Message) int {
+	return EstimateTokens(message.Content) + messageOverhead
+}
+
+// PromptBudget 根据最终参数计算提示词可用的token数，为生成内容预留num_predict（最多预留一半窗口）
+func (s LLMSettings) PromptBudget(options map[string]interface{}) int {
+	numCtx := s.Context.DefaultNumCtx
+	if numCtx <= 0 {
+		numCtx = defaultNumCtx
+	}
+	if value, ok := toFloat(options["num_ctx"]); ok && value > 0 {
+		numCtx = int(value)
+	}
+
+	reserve := numCtx / 2
+	if value, ok := toFloat(options["num_predict"]); ok && value >= 0 && int(value) < reserve {
+		reserve = int(value)
+	}
+	return numCtx - reserve
+}
+
+// FitContext 按策略截断消息，使其不超过budget
+// 开头的系统消息和最后一条消息始终保留，返回保留的消息和截断结果，budget不大于0时返回ErrInvalidBudget
+func FitContext(messages []Message, budget int, strategy string) ([]Message, ContextReport, error) {
+	report := ContextReport{Strategy: strategy, Budget: budget, Omitted: []int{}}
+	if budget <= 0 {
+		return nil, report, ErrInvalidBudget
+	}
+
+	tokens := make([]int, len(messages))
+	total := 0
+	for i, message := range messages {
+		tokens[i] = EstimateMessageTokens(message)
+		total += tokens[i]
+	}
+	report.EstimatedTokens = total
+	if strategy == ContextStrategyNone || total <= budget || len(messages) < 2 {
+		return messages, report, nil
+	}
+
+	// 开头的系统消息
+	head := 0
+	for head < len(messages)-1 && messages[head].Role == "system" {
+		head++
+	}
+
+	// drop_middle策略额外保留第一轮对话（第一条用户消息和紧随其后的回复）
+	if strategy == ContextStrategyDropMiddle {
+		keepFirst := head
+		if keepFirst < len(messages)-1 && messages[keepFirst].Role == "user" {
+			keepFirst++
+			if keepFirst < len(messages)-1 && messages[keepFirst].Role == "assistant" {
+				keepFirst++
+			}
+		}
+		head = keepFirst
+	}
+
+	// 从最早的可丢弃消息开始丢弃，直到满足预算；最后一条消息始终保留
+	omitted := make(map[int]bool)
+	for i := head; i < len(messages)-1 && total > budget; i++ {
+		omitted[i] = true
+		total -= tokens[i]
+	}
+
+	// 丢弃后以assistant消息开头时一并丢弃，避免对话以回复开头
+	for i := head; i < len(messages)-1; i++ {
+		if omitted[i] {
+			continue
+		}
+		if messages[i].Role == "assistant" || messages[i].Role == "tool" {
+			omitted[i] = true
+			total -= tokens[i]
+			continue
+		}
+		break
+	}
+
+	kept := make([]Message, 0, len(messages)-len(omitted))
+	for i, message := range messages {
+		if omitted[i] {
+			report.Omitted = append(report.Omitted, i)
+			continue
+		}
+		kept = append(kept, message)
+	}
+	report.EstimatedTokens = total
+	return kept, report, nil
+}
+
+// validateContextSettings 校验上下文窗口配置
+func validateContextSettings(settings ContextSettings) error {
+	if !ValidContextStrategy(settings.Strategy) {
+		return fmt.Errorf("无效的上下文截断策略: %s", settings.Strategy)
+	}
+	if settings.DefaultNumCtx <= 0 {
+		return fmt.Errorf("default_num_ctx必须大于0")
+	}
+	return nil
+}
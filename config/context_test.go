@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFitContext(t *testing.T) {
+	// 每条消息8个token：4个字符的内容加上消息开销
+	long := strings.Repeat("长", 4)
+	system := Message{Role: "system", Content: long}
+	user1 := Message{Role: "user", Content: long}
+	reply1 := Message{Role: "assistant", Content: long}
+	user2 := Message{Role: "user", Content: long}
+	reply2 := Message{Role: "assistant", Content: long}
+	latest := Message{Role: "user", Content: "最新"}
+	conversation := []Message{system, user1, reply1, user2, reply2, latest}
+
+	tests := []struct {
+		name     string
+		messages []Message
+		budget   int
+		strategy string
+		want     []Message
+		omitted  []int
+	}{
+		{
+			name:     "未超过预算时不截断",
+			messages: conversation,
+			budget:   100,
+			strategy: ContextStrategySlidingWindow,
+			want:     conversation,
+			omitted:  []int{},
+		},
+		{
+			name:     "滑动窗口保留系统提示词和最新的用户消息",
+			messages: conversation,
+			budget:   30,
+			strategy: ContextStrategySlidingWindow,
+			want:     []Message{system, user2, reply2, latest},
+			omitted:  []int{1, 2},
+		},
+		{
+			name:     "丢弃后不以回复开头",
+			messages: conversation,
+			budget:   22,
+			strategy: ContextStrategySlidingWindow,
+			want:     []Message{system, latest},
+			omitted:  []int{1, 2, 3, 4},
+		},
+		{
+			name:     "丢弃中间的消息",
+			messages: conversation,
+			budget:   30,
+			strategy: ContextStrategyDropMiddle,
+			want:     []Message{system, user1, reply1, latest},
+			omitted:  []int{3, 4},
+		},
+		{
+			name:     "预算很小时仍保留系统提示词和最新的用户消息",
+			messages: conversation,
+			budget:   1,
+			strategy: ContextStrategySlidingWindow,
+			want:     []Message{system, latest},
+			omitted:  []int{1, 2, 3, 4},
+		},
+		{
+			name:     "单条消息超过预算",
+			messages: []Message{{Role: "user", Content: strings.Repeat("长", 100)}},
+			budget:   10,
+			strategy: ContextStrategySlidingWindow,
+			want:     []Message{{Role: "user", Content: strings.Repeat("长", 100)}},
+			omitted:  []int{},
+		},
+		{
+			name:     "none策略不截断",
+			messages: conversation,
+			budget:   10,
+			strategy: ContextStrategyNone,
+			want:     conversation,
+			omitted:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report, err := FitContext(tt.messages, tt.budget, tt.strategy)
+			if err != nil {
+				t.Fatalf("FitContext() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FitContext() = %v, 期望 %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(report.Omitted, tt.omitted) {
+				t.Errorf("Omitted = %v, 期望 %v", report.Omitted, tt.omitted)
+			}
+		})
+	}
+}
+
+func TestFitContextRejectsEmptyBudget(t *testing.T) {
+	for _, budget := range []int{0, -1} {
+		_, _, err := FitContext([]Message{{Role: "user", Content: "你好"}}, budget, ContextStrategySlidingWindow)
+		if !errors.Is(err, ErrInvalidBudget) {
+			t.Errorf("budget=%d 时 error = %v, 期望 %v", budget, err, ErrInvalidBudget)
+		}
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	settings := LLMSettings{Context: ContextSettings{DefaultNumCtx: 4096}}
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		want    int
+	}{
+		{"默认窗口预留一半", nil, 2048},
+		{"按num_predict预留", map[string]interface{}{"num_ctx": 8192, "num_predict": 1024}, 7168},
+		{"num_predict最多预留一半", map[string]interface{}{"num_ctx": 1000, "num_predict": 5000}, 500},
+		{"窗口过小", map[string]interface{}{"num_ctx": 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.PromptBudget(tt.options); got != tt.want {
+				t.Errorf("PromptBudget() = %d, 期望 %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EmbedRequest Ollama向量嵌入请求结构
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbedResponse Ollama向量嵌入响应结构
+type EmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float32 `json:"embeddings"`
+	TotalDuration   int64       `json:"total_duration"`
+	LoadDuration    int64       `json:"load_duration"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+}
+
+// Embed 计算一组文本的向量，返回的向量与输入一一对应
+func (c *LLMClient) Embed(model string, input []string) (resp *EmbedResponse, err error) {
+	ctx, span, cancel := c.startSpan("llm.embed", model)
+	defer cancel()
+	defer func() { endSpan(span, err) }()
+
+	reqBody, err := json.Marshal(EmbedRequest{Model: model, Input: input})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	// 与聊天请求使用同一个后端池
+	ctx, cancelTimeout := c.requestTimeout(ctx, model)
+	defer cancelTimeout()
+	httpResp, _, err := c.send(ctx, model, Backend.EmbedURL, reqBody, "")
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	// 解析响应
+	var embedResp EmbedResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&embedResp); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if len(embedResp.Embeddings) != len(input) {
+		return nil, fmt.Errorf("向量数量与输入不一致: %d != %d", len(embedResp.Embeddings), len(input))
+	}
+
+	return &embedResp, nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// EmbeddingSettings 向量嵌入接口配置
+type EmbeddingSettings struct {
+	Models   []string `yaml:"models"`    // 允许使用的向量模型，为空表示不限制
+	CacheDir string   `yaml:"cache_dir"` // 向量缓存目录，为空表示不缓存
+}
+
+// ModelAllowed 判断向量模型是否在允许列表中
+func (s EmbeddingSettings) ModelAllowed(model string) bool {
+	if len(s.Models) == 0 {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbeddingCache 以模型和文本哈希为键的磁盘向量缓存
+type EmbeddingCache struct {
+	dir string
+}
+
+// NewEmbeddingCache 创建向量缓存，dir为空时返回nil，表示不缓存
+func NewEmbeddingCache(dir string) *EmbeddingCache {
+	if dir == "" {
+		return nil
+	}
+	return &EmbeddingCache{dir: dir}
+}
+
+// path 返回缓存文件路径，按哈希前两位分目录
+func (c *EmbeddingCache) path(model, text string) string {
+	hash := sha256.Sum256([]byte(model + "\x00" + text))
+	key := hex.EncodeToString(hash[:])
+	return filepath.Join(c.dir, key[:2], key+".bin")
+}
+
+// Get 读取缓存的向量，不存在或读取失败时返回false
+func (c *EmbeddingCache) Get(model, text string) ([]float32, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(model, text))
+	if err != nil || len(data)%4 != 0 {
+		return nil, false
+	}
+	vector := make([]float32, len(data)/4)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, vector); err != nil {
+		return nil, false
+	}
+	return vector, true
+}
+
+// Put 写入缓存，先写临时文件再重命名，避免读到写了一半的文件
+func (c *EmbeddingCache) Put(model, text string, vector []float32) error {
+	if c == nil {
+		return nil
+	}
+	path := c.path(model, text)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, vector); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// formatRetryPrompt 输出不符合格式时追加的纠正提示
+const formatRetryPrompt = "上面的输出不符合要求的格式：\n%s\n请只输出符合要求的JSON，不要包含其他内容。"
+
+// formatSchemaURL 编译请求中的JSON Schema时使用的资源地址
+const formatSchemaURL = "mem:///format.json"
+
+// schemaError JSON Schema编译失败，Error只返回固定的信息，避免把加载失败的地址等内容返回给客户端
+// 原因通过Unwrap获取，只用于记录日志
+type schemaError struct {
+	err error
+}
+
+// Error 实现error接口
+func (e *schemaError) Error() string {
+	return "JSON Schema无效"
+}
+
+// Unwrap 返回编译失败的原因
+func (e *schemaError) Unwrap() error {
+	return e.err
+}
+
+// OutputFormat 结构化输出格式，"json"表示任意JSON，对象表示JSON Schema
+type OutputFormat struct {
+	Raw    json.RawMessage // 原样传给Ollama的format参数
+	schema *jsonschema.Schema
+}
+
+// ParseOutputFormat 解析请求中的format字段，为空时返回nil
+func ParseOutputFormat(raw json.RawMessage) (*OutputFormat, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		if name != "json" {
+			return nil, fmt.Errorf("不支持的输出格式: %s", name)
+		}
+		return &OutputFormat{Raw: raw}, nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, errors.New("format必须是\"json\"或JSON Schema对象")
+	}
+	// 只允许引用请求中的Schema本身，不加载本地文件或远程地址
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		if url == formatSchemaURL {
+			return io.NopCloser(bytes.NewReader(raw)), nil
+		}
+		return nil, fmt.Errorf("不允许引用外部Schema: %s", url)
+	}
+	if err := compiler.AddResource(formatSchemaURL, bytes.NewReader(raw)); err != nil {
+		return nil, &schemaError{err: err}
+	}
+	schema, err := compiler.Compile(formatSchemaURL)
+	if err != nil {
+		return nil, &schemaError{err: err}
+	}
+	return &OutputFormat{Raw: raw, schema: schema}, nil
+}
+
+// Validate 解析并校验模型输出，返回解析后的对象和校验错误，校验通过时错误列表为空
+func (f *OutputFormat) Validate(content string) (interface{}, []string) {
+	content = trimCodeFence(content)
+
+	var parsed interface{}
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, []string{"输出不是有效的JSON: " + err.Error()}
+	}
+	if decoder.More() {
+		return nil, []string{"输出包含多余的内容"}
+	}
+	if f.schema == nil {
+		return parsed, []string{}
+	}
+
+	if err := f.schema.Validate(parsed); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if errors.As(err, &validationErr) {
+			return parsed, validationMessages(validationErr)
+		}
+		return parsed, []string{err.Error()}
+	}
+	return parsed, []string{}
+}
+
+// RetryMessages 构建格式校验失败后重试的消息：原消息、无效的输出和纠正提示
+func (f *OutputFormat) RetryMessages(messages []Message, output string, errs []string) []Message {
+	retry := make([]Message, 0, len(messages)+2)
+	retry = append(retry, messages...)
+	return append(retry,
+		Message{Role: "assistant", Content: output},
+		Message{Role: "user", Content: fmt.Sprintf(formatRetryPrompt, strings.Join(errs, "\n"))},
+	)
+}
+
+// validationMessages 展开校验错误，只保留最底层的具体错误
+func validationMessages(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{location + ": " + err.Message}
+	}
+	var messages []string
+	for _, cause := range err.Causes {
+		messages = append(messages, validationMessages(cause)...)
+	}
+	return messages
+}
+
+// trimCodeFence 去掉模型可能包裹在输出外的```json代码块
+func trimCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	content = strings.TrimPrefix(content, "```")
+	if idx := strings.Index(content, "\n"); idx >= 0 {
+		content = content[idx+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+}
@@ -2,101 +2,268 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
+
+	"github.com/trae-ds-go-backend/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LLMConfig 模型配置
 type LLMConfig struct {
-	APIURL     string
-	MaxTokens  int
+	APIURL      string
+	MaxTokens   int
 	Temperature float64
 	Timeout     time.Duration
 }
 
 // DefaultLLMConfig 默认模型配置
 var DefaultLLMConfig = LLMConfig{
-	APIURL:     "http://localhost:11434/api/chat", // 默认本地deepseek模型API地址
-	MaxTokens:  2048,                                       // 默认最大生成token数
-	Temperature: 0.7,                                        // 默认温度参数
-	Timeout:     time.Second * 120,                           // 默认超时时间
+	APIURL:      "http://localhost:11434/api/chat", // 默认本地deepseek模型API地址
+	MaxTokens:   2048,                              // 默认最大生成token数
+	Temperature: 0.7,                               // 默认温度参数
+	Timeout:     time.Second * 120,                 // 默认超时时间
 }
 
 // Message 聊天消息结构
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Reasoning string `json:"reasoning,omitempty"` // 推理模型的思考过程，单独存储，发送给模型前会被去掉
+
+	Attachments []uint   `json:"attachments,omitempty"` // 引用的附件ID，历史记录中只保存引用
+	Images      []string `json:"images,omitempty"`      // 发送给Ollama的base64图片，由附件转换而来
+
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"` // assistant消息请求调用的工具
+	ToolName  string     `json:"tool_name,omitempty"`  // tool消息对应的工具名称
+}
+
+// ToolDefinition 发送给模型的工具定义
+type ToolDefinition struct {
+	Type     string       `json:"type"` // 固定为function
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction 工具的函数描述
+type ToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON Schema格式的参数定义
+}
+
+// ToolCall 模型返回的工具调用
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction 工具调用的函数名和参数
+type ToolCallFunction struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
 }
 
 // ChatRequest 聊天请求结构
 type ChatRequest struct {
-	Model    string                  `json:"model"`
-	Messages []Message               `json:"messages"`
+	Model    string                 `json:"model"`
+	Messages []Message              `json:"messages"`
+	Stream   bool                   `json:"stream"` // Ollama默认流式返回，非流式请求必须显式设置为false
 	Options  map[string]interface{} `json:"options"`
+	Tools    []ToolDefinition       `json:"tools,omitempty"`
+	Format   json.RawMessage        `json:"format,omitempty"` // "json"或JSON Schema，约束模型输出
 }
 
-// ChatResponse 聊天响应结构
+// ChatParams 聊天请求的可选参数
+type ChatParams struct {
+	Tools  []ToolDefinition // 可供模型调用的工具
+	Format json.RawMessage  // 输出格式
+}
+
+// ChatResponse Ollama聊天响应结构，流式响应的每一行也是这个结构
 type ChatResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index   int `json:"index"`
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Model              string  `json:"model"`
+	CreatedAt          string  `json:"created_at"`
+	Message            Message `json:"message"`
+	Done               bool    `json:"done"`
+	DoneReason         string  `json:"done_reason,omitempty"`
+	TotalDuration      int64   `json:"total_duration,omitempty"`       // 总耗时，单位纳秒
+	LoadDuration       int64   `json:"load_duration,omitempty"`        // 模型加载耗时，单位纳秒
+	PromptEvalCount    int     `json:"prompt_eval_count,omitempty"`    // 提示词token数
+	PromptEvalDuration int64   `json:"prompt_eval_duration,omitempty"` // 提示词处理耗时，单位纳秒
+	EvalCount          int     `json:"eval_count,omitempty"`           // 生成token数
+	EvalDuration       int64   `json:"eval_duration,omitempty"`        // 生成耗时，单位纳秒
+}
+
+// Usage token用量统计
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Usage 返回响应的token用量
+func (r *ChatResponse) Usage() Usage {
+	return Usage{
+		PromptTokens:     r.PromptEvalCount,
+		CompletionTokens: r.EvalCount,
+		TotalTokens:      r.PromptEvalCount + r.EvalCount,
+	}
 }
 
 // LLMClient 模型客户端
 type LLMClient struct {
-	Config LLMConfig
-	Client *http.Client
+	Config   LLMConfig
+	Client   *http.Client
+	Pool     *BackendPool
+	Settings LLMSettings  // 用于计算模型参数的默认值和上限
+	Logger   *slog.Logger // 日志记录器，调用方可以替换为带请求ID的记录器
+
+	// Context 发起模型请求的上下文，用于关联链路追踪，为空时模型请求作为新的链路
+	// 只传递链路信息，客户端断开时不会取消模型请求，服务关闭时由CutOffRequests中断
+	Context context.Context
 }
 
-// NewLLMClient 创建新的模型客户端
-func NewLLMClient() *LLMClient {
-	// 从环境变量获取配置
-	apiURL := os.Getenv("LLM_API_URL")
-	if apiURL == "" {
-		apiURL = DefaultLLMConfig.APIURL
+// NewLLMClient 根据当前配置创建新的模型客户端
+func NewLLMClient(settings LLMSettings) *LLMClient {
+	// 未初始化全局后端池时，使用配置中的后端临时创建
+	// 后端配置无效时使用空的后端池，模型请求返回ErrNoBackend
+	pool := DefaultPool
+	if pool == nil {
+		var err error
+		if pool, err = NewBackendPool(settings.Backends); err != nil {
+			slog.Error("LLM后端配置无效", "error", err)
+			pool = emptyBackendPool()
+		}
 	}
 
 	// 创建客户端
 	client := &LLMClient{
 		Config: LLMConfig{
-			APIURL:     apiURL,
-			MaxTokens:  DefaultLLMConfig.MaxTokens,
-			Temperature: DefaultLLMConfig.Temperature,
-			Timeout:     DefaultLLMConfig.Timeout,
+			MaxTokens:   settings.MaxTokens,
+			Temperature: settings.Temperature,
+			Timeout:     settings.Timeout,
 		},
+		// 不设置整体超时，非流式请求由requestTimeout限制，流式请求按输出间隔判断超时
 		Client: &http.Client{
-			Timeout: DefaultLLMConfig.Timeout,
+			Transport: llmTransport,
 		},
+		Pool:     pool,
+		Settings: settings,
+		Logger:   slog.Default(),
 	}
 
 	return client
 }
 
-// Chat 发送聊天请求并获取响应
-func (c *LLMClient) Chat(messages []Message, options map[string]interface{}) (*ChatResponse, error) {
+// startSpan 为一次模型请求创建span，返回的cancel用于释放请求上下文
+func (c *LLMClient) startSpan(name, model string) (context.Context, trace.Span, context.CancelFunc) {
+	ctx, cancel := requestContext(c.Context)
+	ctx, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("llm.model", model)))
+	return ctx, span, cancel
+}
+
+// requestTimeout 为非流式请求设置连接超时和整体超时
+func (c *LLMClient) requestTimeout(ctx context.Context, model string) (context.Context, context.CancelFunc) {
+	ctx = withConnectTimeout(ctx, c.Settings.ResolveTimeouts(model).Connect)
+	if c.Config.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.Config.Timeout)
+}
+
+// endSpan 记录错误并结束span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// send 将请求发送到提供该模型的后端的指定接口，连接被拒绝时自动切换到下一个后端
+// 请求头中带有traceparent，后端可以将自己的span关联到同一条链路
+// 返回实际处理请求的后端名称，后端出错时返回分类后的*UpstreamError
+func (c *LLMClient) send(ctx context.Context, model string, endpoint func(Backend) string, reqBody []byte, accept string) (*http.Response, string, error) {
+	if shutdownCtx.Err() != nil {
+		return nil, "", ErrShuttingDown
+	}
+	candidates := c.Pool.Candidates(model)
+	if len(candidates) == 0 && len(c.Pool.Backends()) == 0 {
+		return nil, "", &UpstreamError{Kind: UpstreamUnavailable, Message: "发送请求失败", Err: ErrNoBackend}
+	}
+	if len(candidates) == 0 {
+		return nil, "", &UpstreamError{Kind: UpstreamModelNotFound, Message: fmt.Sprintf("没有提供模型%s的后端", model)}
+	}
+
+	var lastErr error
+	for _, backend := range candidates {
+		// 创建HTTP请求
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint(backend), bytes.NewBuffer(reqBody))
+		if err != nil {
+			return nil, "", fmt.Errorf("创建请求失败: %v", err)
+		}
+
+		// 设置请求头
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("llm.backend", backend.Name))
+
+		// 发送请求
+		resp, err := c.Client.Do(req)
+		if err != nil {
+			if shutdownCtx.Err() != nil {
+				return nil, "", ErrShuttingDown
+			}
+			// 连接阶段失败时尚未有任何数据返回，可以切换到下一个后端
+			if isConnectError(err) {
+				metrics.UpstreamErrors.WithLabelValues(backend.Name, "connect").Inc()
+				span.AddEvent("backend_down", trace.WithAttributes(attribute.String("llm.backend", backend.Name)))
+				c.Pool.MarkDown(backend.Name, err)
+				lastErr = fmt.Errorf("后端%s连接失败: %v", backend.Name, err)
+				continue
+			}
+			metrics.UpstreamErrors.WithLabelValues(backend.Name, "request").Inc()
+			return nil, "", &UpstreamError{Kind: classifyUpstream(0, "", err), Backend: backend.Name, Message: "发送请求失败", Err: err}
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode != http.StatusOK {
+			metrics.UpstreamErrors.WithLabelValues(backend.Name, "status").Inc()
+			defer resp.Body.Close()
+			return nil, "", upstreamStatusError(backend.Name, resp)
+		}
+		return resp, backend.Name, nil
+	}
+
+	return nil, "", &UpstreamError{Kind: UpstreamUnavailable, Message: "发送请求失败，所有后端均不可用", Err: lastErr}
+}
+
+// Chat 发送非流式聊天请求并获取完整响应
+func (c *LLMClient) Chat(messages []Message, options map[string]interface{}, model string, params ChatParams) (resp *ChatResponse, err error) {
+	ctx, span, cancel := c.startSpan("llm.chat", model)
+	defer cancel()
+	defer func() { endSpan(span, err) }()
+
 	// 准备请求数据
 	reqData := ChatRequest{
-		Model:    "deepseek-r1:7b", // 使用deepseek模型
+		Model:    model,
 		Messages: messages,
-		Options:  options,
+		Stream:   false,
+		Options:  c.Settings.ResolveOptions(model, options),
+		Tools:    params.Tools,
+		Format:   params.Format,
 	}
 
 	// 序列化请求数据
@@ -105,47 +272,27 @@ func (c *LLMClient) Chat(messages []Message, options map[string]interface{}) (*C
 		return nil, fmt.Errorf("序列化请求失败: %v", err)
 	}
 
-	// 打印请求信息
-	reqJSON, _ := json.MarshalIndent(reqData, "", "  ")
-	fmt.Println("发送给模型的请求数据:")
-	fmt.Println(string(reqJSON))
-
-	// 打印完整请求信息
-	fmt.Println("\n完整请求信息:")
-	fmt.Printf("请求URL: %s\n", c.Config.APIURL)
-	fmt.Println("请求方法: POST")
-	fmt.Println("请求头信息:")
-	fmt.Println("Content-Type: application/json")
-	fmt.Println("\n请求体原始数据:")
-	fmt.Println(string(reqBody))
-
-	// 创建HTTP请求
-	req, err := http.NewRequest("POST", c.Config.APIURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
-	}
-
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
+	// 记录请求信息，提示词内容默认脱敏
+	c.Logger.Debug("发送模型请求", "model", model, "messages", len(messages), LogContent("request", string(reqBody)))
 
-	// 发送请求
-	resp, err := c.Client.Do(req)
+	// 发送请求到后端池
+	ctx, cancelTimeout := c.requestTimeout(ctx, model)
+	defer cancelTimeout()
+	httpResp, _, err := c.send(ctx, reqData.Model, Backend.ChatURL, reqBody, "")
 	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return nil, err
 	}
+	defer httpResp.Body.Close()
 
 	// 解析响应
 	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+	if err := json.NewDecoder(httpResp.Body).Decode(&chatResp); err != nil {
 		return nil, fmt.Errorf("解析响应失败: %v", err)
 	}
+	span.SetAttributes(
+		attribute.Int("llm.usage.prompt_tokens", chatResp.PromptEvalCount),
+		attribute.Int("llm.usage.completion_tokens", chatResp.EvalCount),
+	)
 
 	return &chatResp, nil
 }
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// 日志输出格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logContent 是否在日志中输出提示词和回复内容
+var logContent atomic.Bool
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level   string `yaml:"level"`   // 日志级别：debug、info、warn、error
+	Format  string `yaml:"format"`  // 输出格式：text、json，为空时release模式使用json，其他模式使用text
+	Content bool   `yaml:"content"` // 是否在debug日志中输出提示词和回复内容，默认脱敏
+}
+
+// SetupLogging 根据配置设置全局的slog日志，mode为Gin运行模式
+func SetupLogging(cfg LogConfig, mode string) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	format := cfg.Format
+	if format == "" {
+		format = LogFormatText
+		if mode == "release" {
+			format = LogFormatJSON
+		}
+	}
+
+	var handler slog.Handler
+	if format == LogFormatJSON {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(handler))
+	logContent.Store(cfg.Content)
+}
+
+// LogContent 返回记录提示词或回复内容的日志属性，未开启content时只记录长度
+func LogContent(key, text string) slog.Attr {
+	if logContent.Load() {
+		return slog.String(key, text)
+	}
+	return slog.String(key, fmt.Sprintf("[REDACTED %d chars]", utf8.RuneCountInString(text)))
+}
+
+// validateLogConfig 校验日志配置
+func validateLogConfig(cfg LogConfig) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("无效的日志级别: %s", cfg.Level)
+	}
+	switch cfg.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("无效的日志格式: %s", cfg.Format)
+	}
+	return nil
+}
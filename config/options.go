@@ -0,0 +1,123 @@
+package config
+
+import "math"
+
+// ModelConfig 单个模型的配置
+type ModelConfig struct {
+	Options  map[string]interface{} `yaml:"options"`  // 模型默认参数，使用Ollama参数名
+	Timeouts TimeoutSettings        `yaml:"timeouts"` // 覆盖全局的流式请求超时，为0的项使用全局设置
+}
+
+// optionAliases 常见的OpenAI风格参数名到Ollama参数名的映射
+var optionAliases = map[string]string{
+	"max_tokens":            "num_predict",
+	"max_completion_tokens": "num_predict",
+	"max_new_tokens":        "num_predict",
+	"context_length":        "num_ctx",
+	"n_ctx":                 "num_ctx",
+	"stop_sequences":        "stop",
+}
+
+// ollamaOptions Ollama支持的生成参数
+var ollamaOptions = map[string]bool{
+	"num_keep":          true,
+	"seed":              true,
+	"num_predict":       true,
+	"top_k":             true,
+	"top_p":             true,
+	"min_p":             true,
+	"typical_p":         true,
+	"repeat_last_n":     true,
+	"temperature":       true,
+	"repeat_penalty":    true,
+	"presence_penalty":  true,
+	"frequency_penalty": true,
+	"mirostat":          true,
+	"mirostat_tau":      true,
+	"mirostat_eta":      true,
+	"penalize_newline":  true,
+	"stop":              true,
+	"numa":              true,
+	"num_ctx":           true,
+	"num_batch":         true,
+	"num_gpu":           true,
+	"main_gpu":          true,
+	"low_vram":          true,
+	"use_mmap":          true,
+	"use_mlock":         true,
+	"num_thread":        true,
+}
+
+// NormalizeOptions 将参数名转换为Ollama参数名，并丢弃Ollama不支持的参数
+func NormalizeOptions(options map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		if alias, ok := optionAliases[key]; ok {
+			key = alias
+		}
+		if ollamaOptions[key] {
+			normalized[key] = value
+		}
+	}
+	return normalized
+}
+
+// MergeOptions 按顺序合并多层参数，后面的参数覆盖前面的
+func MergeOptions(layers ...map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, layer := range layers {
+		for key, value := range NormalizeOptions(layer) {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// ResolveOptions 计算最终发送给模型的参数
+// 优先级从低到高：服务器默认值、模型默认值、调用方传入的参数（用户偏好和请求参数已合并），最后应用服务器上限
+func (s LLMSettings) ResolveOptions(model string, options map[string]interface{}) map[string]interface{} {
+	serverDefaults := map[string]interface{}{
+		"num_predict": s.MaxTokens,
+		"temperature": s.Temperature,
+	}
+	resolved := MergeOptions(serverDefaults, s.ModelConfigs[model].Options, options)
+
+	// 应用服务器上限
+	limits := s.Limits
+	clampOption(resolved, "num_predict", limits.MaxNumPredict)
+	clampOption(resolved, "num_ctx", limits.MaxNumCtx)
+	return resolved
+}
+
+// clampOption 将数值参数限制在上限以内，上限为0表示不限制
+// num_predict为负数表示无限生成，设置了上限时同样会被限制
+func clampOption(options map[string]interface{}, key string, ceiling int) {
+	if ceiling <= 0 {
+		return
+	}
+	value, ok := options[key]
+	if !ok {
+		return
+	}
+	number, ok := toFloat(value)
+	if !ok || number < 0 || number > float64(ceiling) {
+		options[key] = ceiling
+	}
+}
+
+// toFloat 将JSON或YAML解析出的数值转换为float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v)
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveOptions(t *testing.T) {
+	settings := LLMSettings{
+		MaxTokens:   2048,
+		Temperature: 0.7,
+		ModelConfigs: map[string]ModelConfig{
+			"qwen2.5": {Options: map[string]interface{}{"temperature": 0.3, "num_ctx": 8192, "top_p": 0.8}},
+		},
+		Limits: LimitsConfig{MaxNumPredict: 4096, MaxNumCtx: 16384},
+	}
+
+	tests := []struct {
+		name    string
+		model   string
+		options map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{
+			name:  "只有服务器默认值",
+			model: "llama3",
+			want:  map[string]interface{}{"num_predict": 2048, "temperature": 0.7},
+		},
+		{
+			name:  "模型默认值覆盖服务器默认值",
+			model: "qwen2.5",
+			want:  map[string]interface{}{"num_predict": 2048, "temperature": 0.3, "num_ctx": 8192, "top_p": 0.8},
+		},
+		{
+			name:    "请求参数覆盖模型默认值",
+			model:   "qwen2.5",
+			options: map[string]interface{}{"temperature": 1.2, "max_tokens": 100},
+			want:    map[string]interface{}{"num_predict": 100, "temperature": 1.2, "num_ctx": 8192, "top_p": 0.8},
+		},
+		{
+			name:    "超过上限时限制为上限",
+			model:   "qwen2.5",
+			options: map[string]interface{}{"num_predict": 100000, "num_ctx": 65536.0},
+			want:    map[string]interface{}{"num_predict": 4096, "temperature": 0.3, "num_ctx": 16384, "top_p": 0.8},
+		},
+		{
+			name:    "无限生成受上限限制",
+			model:   "llama3",
+			options: map[string]interface{}{"num_predict": -1},
+			want:    map[string]interface{}{"num_predict": 4096, "temperature": 0.7},
+		},
+		{
+			name:    "非数值参数替换为上限",
+			model:   "llama3",
+			options: map[string]interface{}{"num_ctx": "big"},
+			want:    map[string]interface{}{"num_predict": 2048, "temperature": 0.7, "num_ctx": 16384},
+		},
+		{
+			name:    "丢弃不支持的参数",
+			model:   "llama3",
+			options: map[string]interface{}{"unknown": 1, "stop_sequences": []interface{}{"\n"}},
+			want:    map[string]interface{}{"num_predict": 2048, "temperature": 0.7, "stop": []interface{}{"\n"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settings.ResolveOptions(tt.model, tt.options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveOptions() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeOptionsLayers(t *testing.T) {
+	// 调用方按用户偏好、预设、请求参数的顺序合并后再交给ResolveOptions
+	preferences := map[string]interface{}{"temperature": 0.2, "top_k": 20}
+	preset := map[string]interface{}{"temperature": 0.9, "max_tokens": 512}
+	request := map[string]interface{}{"max_tokens": 64}
+
+	got := MergeOptions(preferences, preset, request)
+	want := map[string]interface{}{"temperature": 0.9, "top_k": 20, "num_predict": 64}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeOptions() = %v, 期望 %v", got, want)
+	}
+}
+
+func TestClampOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		ceiling int
+		want    interface{}
+	}{
+		{"未超过上限", 100, 200, 100},
+		{"等于上限", 200.0, 200, 200.0},
+		{"超过上限", 300.0, 200, 200},
+		{"负数", -1, 200, 200},
+		{"非数值", "300", 200, 200},
+		{"上限为0不限制", 300, 0, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := map[string]interface{}{"num_predict": tt.value}
+			clampOption(options, "num_predict", tt.ceiling)
+			if got := options["num_predict"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("num_predict = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+
+	options := map[string]interface{}{}
+	clampOption(options, "num_ctx", 100)
+	if _, ok := options["num_ctx"]; ok {
+		t.Error("未设置的参数不应被加入")
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// RAGSettings 知识库检索增强配置
+type RAGSettings struct {
+	EmbeddingModel string  `yaml:"embedding_model"` // 新建知识库默认使用的向量模型
+	ChunkSize      int     `yaml:"chunk_size"`      // 每个分块的最大字符数
+	ChunkOverlap   int     `yaml:"chunk_overlap"`   // 相邻分块重叠的字符数
+	TopK           int     `yaml:"top_k"`           // 每次检索返回的分块数
+	MaxTopK        int     `yaml:"max_top_k"`       // 检索接口中top_k的上限
+	MinScore       float64 `yaml:"min_score"`       // 最低相似度，低于该值的分块不会被引用
+	MaxUploadSize  int64   `yaml:"max_upload_size"` // 上传文档的最大字节数
+}
+
+// Citation 回答引用的知识库分块
+type Citation struct {
+	Index           int     `json:"index"` // 在提示词中的编号，从1开始
+	KnowledgeBaseID uint    `json:"knowledge_base_id"`
+	DocumentID      uint    `json:"document_id"`
+	Filename        string  `json:"filename"`
+	ChunkIndex      int     `json:"chunk_index"` // 分块在文档中的序号
+	Score           float64 `json:"score"`       // 余弦相似度
+	Content         string  `json:"content"`
+}
+
+// ChunkText 将文本按段落切分为不超过size个字符的分块，相邻分块重叠overlap个字符
+func ChunkText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 {
+		return nil
+	}
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = chunkBoundary(runes, start, end)
+		}
+
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// chunkBoundary 在分块后半部分寻找合适的切分位置：优先段落，其次句子，最后空白
+func chunkBoundary(runes []rune, start, end int) int {
+	min := start + (end-start)/2
+	for i := end; i > min; i-- {
+		if runes[i-1] == '\n' && i >= 2 && runes[i-2] == '\n' {
+			return i
+		}
+	}
+	for i := end; i > min; i-- {
+		switch runes[i-1] {
+		case '。', '！', '？', '.', '!', '?', '\n':
+			return i
+		}
+	}
+	for i := end; i > min; i-- {
+		if unicode.IsSpace(runes[i-1]) {
+			return i
+		}
+	}
+	return end
+}
+
+// KnowledgePrompt 构建注入检索结果的系统消息
+func KnowledgePrompt(citations []Citation) Message {
+	var content strings.Builder
+	content.WriteString("以下是从知识库中检索到的参考资料。请优先依据这些资料回答，引用时使用[编号]标注来源；资料中没有相关信息时请如实说明。\n")
+	for _, citation := range citations {
+		fmt.Fprintf(&content, "\n[%d] %s\n%s\n", citation.Index, citation.Filename, citation.Content)
+	}
+	return Message{Role: "system", Content: content.String()}
+}
+
+// validateRAGSettings 校验知识库配置
+func validateRAGSettings(settings RAGSettings) error {
+	if settings.ChunkSize <= 0 {
+		return errors.New("rag.chunk_size必须大于0")
+	}
+	if settings.ChunkOverlap < 0 || settings.ChunkOverlap >= settings.ChunkSize {
+		return errors.New("rag.chunk_overlap必须大于等于0且小于chunk_size")
+	}
+	if settings.TopK <= 0 {
+		return errors.New("rag.top_k必须大于0")
+	}
+	if settings.MaxTopK < settings.TopK {
+		return errors.New("rag.max_top_k不能小于top_k")
+	}
+	if settings.MinScore < -1 || settings.MinScore > 1 {
+		return errors.New("rag.min_score必须在-1到1之间")
+	}
+	if settings.MaxUploadSize <= 0 {
+		return errors.New("rag.max_upload_size必须大于0")
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrShuttingDown 服务关闭的等待期限已到，模型请求被中断
+var ErrShuttingDown = errors.New("服务正在关闭，生成已中断")
+
+// shutdownCtx 服务关闭的等待期限到达时取消，用于中断仍在进行的模型请求
+var shutdownCtx, cutOff = context.WithCancel(context.Background())
+
+// CutOffRequests 中断所有进行中的模型请求，之后发起的模型请求会直接返回ErrShuttingDown
+func CutOffRequests() {
+	cutOff()
+}
+
+// requestContext 返回模型请求使用的上下文，保留parent中的链路信息
+// 客户端断开不会取消模型请求，只有服务关闭时调用CutOffRequests才会取消
+func requestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	stop := context.AfterFunc(shutdownCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
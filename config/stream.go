@@ -1,73 +1,100 @@
 package config
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/trae-ds-go-backend/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// activeStreams 正在进行的流式模型请求数
+var activeStreams atomic.Int64
+
+// ActiveStreams 返回正在进行的流式模型请求数
+func ActiveStreams() int64 {
+	return activeStreams.Load()
+}
+
 // StreamChat 发送聊天请求并以流式方式处理响应
-func (c *LLMClient) StreamChat(w http.ResponseWriter, messages []Message, options map[string]interface{},model string) error {
-	// 准备请求数据
+func (c *LLMClient) StreamChat(w http.ResponseWriter, messages []Message, options map[string]interface{}, model string, params ChatParams) (err error) {
+	ctx, span, cancel := c.startSpan("llm.stream_chat", model)
+	defer cancel()
+	defer func() { endSpan(span, err) }()
+
+	// 准备请求数据，合并服务器默认参数和模型默认参数
 	reqData := ChatRequest{
-		Model:    model, // 使用deepseek模型
+		Model:    model,
 		Messages: messages,
-		Options:  options,
+		Stream:   true,
+		Options:  c.Settings.ResolveOptions(model, options),
+		Tools:    params.Tools,
+		Format:   params.Format,
 	}
 
-	// 添加流式选项
-	if reqData.Options == nil {
-		reqData.Options = make(map[string]interface{})
-	}
-	reqData.Options["stream"] = true
-
 	// 序列化请求数据
 	reqBody, err := json.Marshal(reqData)
 	if err != nil {
 		return fmt.Errorf("序列化请求失败: %v", err)
 	}
 
-	// 创建HTTP请求
-	req, err := http.NewRequest("POST", c.Config.APIURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return fmt.Errorf("创建请求失败: %v", err)
-	}
+	c.Logger.Debug("发送流式模型请求", "model", model, "messages", len(messages), LogContent("request", string(reqBody)))
 
-	// 设置请求头
-	req.Header.Set("Content-Type", "application/json")
-	// 设置Accept头以接收流式响应
-	req.Header.Set("Accept", "text/event-stream")
+	// 统计进行中的流式请求、首个token耗时和生成速度
+	activeStreams.Add(1)
+	defer activeStreams.Add(-1)
+	metricModel := c.Settings.MetricModel(model)
+	metrics.ActiveStreams.WithLabelValues(metricModel).Inc()
+	defer metrics.ActiveStreams.WithLabelValues(metricModel).Dec()
+	meter := &streamMeter{model: metricModel, started: time.Now(), span: span}
 
-	// 发送请求
-	resp, err := c.Client.Do(req)
+	// 按模型的超时设置监控请求，等待第一段输出期间向客户端发送SSE注释
+	timeouts := c.Settings.ResolveTimeouts(model)
+	ctx, watchdog := newStreamWatchdog(withConnectTimeout(ctx, timeouts.Connect), timeouts, w)
+	defer watchdog.stop()
+
+	// 按模型路由发送请求，设置Accept头以接收流式响应
+	// 连接被拒绝时会切换到其他后端，一旦开始返回数据就不再切换
+	resp, backend, err := c.send(ctx, model, Backend.ChatURL, reqBody, "text/event-stream")
 	if err != nil {
-		return fmt.Errorf("发送请求失败: %v", err)
+		if timeoutErr := watchdog.err(ctx, backend); timeoutErr != nil {
+			return timeoutErr
+		}
+		return err
 	}
 	defer resp.Body.Close()
 
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
-	}
-
 	// 设置响应头
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("Transfer-Encoding", "chunked")
 
-	// 创建缓冲区读取器
-	buffer := make([]byte, 1024)
+	// 按行读取Ollama返回的NDJSON，每次向w写入完整的一行，便于调用方逐行解析
+	reader := bufio.NewReader(resp.Body)
 	for {
-		n, err := resp.Body.Read(buffer)
-		if n > 0 {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			watchdog.observe()
+
+			// 生成过程中出错时Ollama返回error行，不作为内容转发，由调用方发送error事件
+			if message := streamLineError(line); message != "" {
+				metrics.UpstreamErrors.WithLabelValues(backend, "stream").Inc()
+				return &UpstreamError{Kind: classifyUpstream(0, message, nil), Backend: backend, Message: "模型生成过程中出错: " + message}
+			}
+			meter.observe(line)
+
 			// 将读取到的数据写入响应
-			if _, err := w.Write(buffer[:n]); err != nil {
-				fmt.Println("写入响应失败:", err)
-				break
+			// 写入失败时返回错误，由调用方保存已生成的部分内容
+			if _, err := w.Write(line); err != nil {
+				c.Logger.Debug("写入流式响应失败", "model", model, "error", err)
+				return fmt.Errorf("写入流式响应失败: %w", err)
 			}
 			// 刷新响应，确保数据立即发送
 			if f, ok := w.(http.Flusher); ok {
@@ -77,12 +104,72 @@ func (c *LLMClient) StreamChat(w http.ResponseWriter, messages []Message, option
 
 		// 检查是否读取完毕
 		if err != nil {
+			// 服务关闭时被中断，由调用方保存已生成的部分内容
+			if err != io.EOF && shutdownCtx.Err() != nil {
+				return ErrShuttingDown
+			}
+			// 读取中断时模型没有正常结束，返回错误由调用方保存已生成的部分内容
+			if timeoutErr := watchdog.err(ctx, backend); timeoutErr != nil {
+				metrics.UpstreamErrors.WithLabelValues(backend, "timeout").Inc()
+				return timeoutErr
+			}
 			if err != io.EOF {
-				fmt.Println("读取响应失败:", err)
+				metrics.UpstreamErrors.WithLabelValues(backend, "stream").Inc()
+				return &UpstreamError{Kind: classifyUpstream(0, "", err), Backend: backend, Message: "读取模型流式响应失败", Err: err}
 			}
 			break
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// streamMeter 在流式代理中统计首个token耗时和生成速度
+type streamMeter struct {
+	model      string     // 监控指标中的模型标签
+	span       trace.Span // 收到第一段内容和结束时在span上记录事件
+	started    time.Time
+	firstToken time.Time // 收到第一段生成内容的时间
+	chunks     int       // 带有生成内容的分片数，模型未返回eval_count时用于估算token数
+}
+
+// observe 处理Ollama返回的一行数据
+func (m *streamMeter) observe(line []byte) {
+	var chunk struct {
+		Message struct {
+			Content   string          `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+		} `json:"message"`
+		Done            bool `json:"done"`
+		PromptEvalCount int  `json:"prompt_eval_count"`
+		EvalCount       int  `json:"eval_count"`
+	}
+	if err := json.Unmarshal(line, &chunk); err != nil {
+		return
+	}
+
+	if chunk.Message.Content != "" || len(chunk.Message.ToolCalls) > 0 {
+		if m.firstToken.IsZero() {
+			m.firstToken = time.Now()
+			metrics.TimeToFirstToken.WithLabelValues(m.model).Observe(m.firstToken.Sub(m.started).Seconds())
+			m.span.AddEvent("first_token")
+		}
+		m.chunks++
+	}
+
+	if chunk.Done {
+		m.span.SetAttributes(
+			attribute.Int("llm.usage.prompt_tokens", chunk.PromptEvalCount),
+			attribute.Int("llm.usage.completion_tokens", chunk.EvalCount),
+		)
+	}
+	if chunk.Done && !m.firstToken.IsZero() {
+		tokens := chunk.EvalCount
+		if tokens == 0 {
+			tokens = m.chunks
+		}
+		if elapsed := time.Since(m.firstToken).Seconds(); elapsed > 0 {
+			metrics.TokensPerSecond.WithLabelValues(m.model).Observe(float64(tokens) / elapsed)
+		}
+	}
+}
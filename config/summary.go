@@ -0,0 +1,75 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// summaryInstruction 生成对话摘要时使用的系统提示词
+const summaryInstruction = "你是一个对话摘要助手。请将下面的对话整理成简洁的摘要，保留用户的目标、已确认的事实、做出的决定和尚未解决的问题，" +
+	"省略寒暄和重复内容。如果提供了之前的摘要，请将其与新的对话合并成一份完整的摘要。只输出摘要内容。"
+
+// SummarySettings 长对话滚动摘要配置
+type SummarySettings struct {
+	Enabled    bool   `yaml:"enabled"`     // 是否启用
+	Threshold  int    `yaml:"threshold"`   // 未被摘要的消息数超过该值时生成摘要
+	KeepRecent int    `yaml:"keep_recent"` // 保留原文的最近消息数
+	Model      string `yaml:"model"`       // 生成摘要使用的模型，为空时使用对话的模型
+	MaxTokens  int    `yaml:"max_tokens"`  // 摘要最大生成token数
+}
+
+// SummaryPrompt 构建生成摘要的消息，previous为之前的摘要
+func SummaryPrompt(previous string, messages []Message) []Message {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("之前的摘要：\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\n")
+	}
+	transcript.WriteString("对话：\n")
+	for _, message := range StripReasoning(messages, false) {
+		if message.Role == "system" {
+			continue
+		}
+		transcript.WriteString(message.Role)
+		transcript.WriteString(": ")
+		transcript.WriteString(message.Content)
+		transcript.WriteString("\n")
+	}
+
+	return []Message{
+		{Role: "system", Content: summaryInstruction},
+		{Role: "user", Content: transcript.String()},
+	}
+}
+
+// MessagesDigest 计算消息角色和回答内容的哈希，用于判断摘要覆盖的消息是否被修改
+func MessagesDigest(messages []Message) string {
+	hash := sha256.New()
+	for _, message := range StripReasoning(messages, false) {
+		hash.Write([]byte(message.Role))
+		hash.Write([]byte{0})
+		hash.Write([]byte(message.Content))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// validateSummarySettings 校验滚动摘要配置
+func validateSummarySettings(settings SummarySettings) error {
+	if !settings.Enabled {
+		return nil
+	}
+	if settings.Threshold <= 0 {
+		return errors.New("summary.threshold必须大于0")
+	}
+	if settings.KeepRecent < 0 || settings.KeepRecent >= settings.Threshold {
+		return errors.New("summary.keep_recent必须大于等于0且小于threshold")
+	}
+	if settings.MaxTokens <= 0 {
+		return errors.New("summary.max_tokens必须大于0")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DeepSeek-R1等推理模型在回复中使用的推理内容标签
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// ThinkSplitter 从流式回复中拆分推理内容和正式回答
+// 标签可能被拆分到多个分片中，未能确定是否为标签的尾部内容会暂存到下一个分片
+type ThinkSplitter struct {
+	inThink    bool
+	afterThink bool // 推理结束后，跳过正式回答开头的空白
+	pending    string
+}
+
+// Push 处理一个分片，返回其中的推理内容和回答内容
+func (s *ThinkSplitter) Push(chunk string) (reasoning, answer string) {
+	text := s.pending + chunk
+	s.pending = ""
+
+	var reasoningBuf, answerBuf strings.Builder
+	for text != "" {
+		tag := thinkOpenTag
+		if s.inThink {
+			tag = thinkCloseTag
+		}
+
+		if idx := strings.Index(text, tag); idx >= 0 {
+			s.emit(text[:idx], &reasoningBuf, &answerBuf)
+			text = text[idx+len(tag):]
+			if s.inThink {
+				s.afterThink = true
+			}
+			s.inThink = !s.inThink
+			continue
+		}
+
+		// 末尾可能是标签的前半部分，暂存等待下一个分片
+		keep := partialTagSuffix(text, tag)
+		s.emit(text[:len(text)-keep], &reasoningBuf, &answerBuf)
+		s.pending = text[len(text)-keep:]
+		break
+	}
+
+	return reasoningBuf.String(), answerBuf.String()
+}
+
+// Flush 流结束时输出暂存的内容
+func (s *ThinkSplitter) Flush() (reasoning, answer string) {
+	var reasoningBuf, answerBuf strings.Builder
+	s.emit(s.pending, &reasoningBuf, &answerBuf)
+	s.pending = ""
+	return reasoningBuf.String(), answerBuf.String()
+}
+
+// emit 根据当前状态将文本写入推理内容或回答内容
+func (s *ThinkSplitter) emit(text string, reasoning, answer *strings.Builder) {
+	if s.inThink {
+		reasoning.WriteString(text)
+		return
+	}
+	if s.afterThink {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			return
+		}
+		s.afterThink = false
+	}
+	answer.WriteString(text)
+}
+
+// partialTagSuffix 返回text末尾与tag前缀相同的最大长度
+func partialTagSuffix(text, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// SplitReasoning 拆分完整回复中的推理内容和正式回答
+func SplitReasoning(content string) (reasoning, answer string) {
+	var splitter ThinkSplitter
+	reasoning, answer = splitter.Push(content)
+	restReasoning, restAnswer := splitter.Flush()
+	return strings.TrimSpace(reasoning + restReasoning), answer + restAnswer
+}
+
+// StripReasoning 重新构建提示词时去掉历史回复中的推理内容，避免推理过程被再次发送给模型
+// keep为true时将推理内容以<think>标签的形式放回回复中
+func StripReasoning(messages []Message, keep bool) []Message {
+	prompt := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "assistant" {
+			reasoning, answer := SplitReasoning(message.Content)
+			if message.Reasoning != "" {
+				reasoning = message.Reasoning
+			}
+			message.Content = answer
+			if keep && reasoning != "" {
+				message.Content = thinkOpenTag + reasoning + thinkCloseTag + "\n\n" + answer
+			}
+		}
+		message.Reasoning = ""
+		prompt = append(prompt, message)
+	}
+	return prompt
+}
@@ -0,0 +1,97 @@
+package config
+
+import "testing"
+
+func TestThinkSplitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunks    []string
+		reasoning string
+		answer    string
+	}{
+		{
+			name:      "整段回复",
+			chunks:    []string{"<think>推理</think>\n\n回答"},
+			reasoning: "推理",
+			answer:    "回答",
+		},
+		{
+			name:      "开始标签跨分片",
+			chunks:    []string{"<th", "ink>推理</think>回答"},
+			reasoning: "推理",
+			answer:    "回答",
+		},
+		{
+			name:      "结束标签跨分片",
+			chunks:    []string{"<think>推理</", "thi", "nk>\n回答"},
+			reasoning: "推理",
+			answer:    "回答",
+		},
+		{
+			name:      "逐字符输出",
+			chunks:    []string{"<", "t", "h", "i", "n", "k", ">", "想", "<", "/", "t", "h", "i", "n", "k", ">", "答"},
+			reasoning: "想",
+			answer:    "答",
+		},
+		{
+			name:      "推理未结束",
+			chunks:    []string{"<think>推理", "还没有结束"},
+			reasoning: "推理还没有结束",
+		},
+		{
+			name:      "推理未结束且末尾是不完整的结束标签",
+			chunks:    []string{"<think>推理</th"},
+			reasoning: "推理</th",
+		},
+		{
+			name:      "推理前后都有回答",
+			chunks:    []string{"前言<think>推理", "</think>  后文"},
+			reasoning: "推理",
+			answer:    "前言后文",
+		},
+		{
+			name:   "没有推理内容",
+			chunks: []string{"普通", "回答"},
+			answer: "普通回答",
+		},
+		{
+			name:   "看起来像标签的普通内容",
+			chunks: []string{"a <thin", "g> b"},
+			answer: "a <thing> b",
+		},
+		{
+			name:   "结尾是不完整的开始标签",
+			chunks: []string{"回答<thi"},
+			answer: "回答<thi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var splitter ThinkSplitter
+			var reasoning, answer string
+			for _, chunk := range tt.chunks {
+				r, a := splitter.Push(chunk)
+				reasoning += r
+				answer += a
+			}
+			r, a := splitter.Flush()
+			reasoning += r
+			answer += a
+
+			if reasoning != tt.reasoning {
+				t.Errorf("推理内容 = %q, 期望 %q", reasoning, tt.reasoning)
+			}
+			if answer != tt.answer {
+				t.Errorf("回答内容 = %q, 期望 %q", answer, tt.answer)
+			}
+		})
+	}
+}
+
+func TestSplitReasoning(t *testing.T) {
+	reasoning, answer := SplitReasoning("<think>\n推理\n</think>\n\n回答")
+	if reasoning != "推理" || answer != "回答" {
+		t.Errorf("SplitReasoning() = %q, %q", reasoning, answer)
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 流式请求超时的默认值
+const (
+	defaultConnectTimeout    = time.Second * 10
+	defaultFirstTokenTimeout = time.Minute * 5 // 包括模型加载和提示词处理，大模型冷启动可能需要几分钟
+	defaultIdleTimeout       = time.Minute
+	defaultKeepAliveInterval = time.Second * 15
+)
+
+// keepAliveComment 等待模型输出时发送给客户端的SSE注释，客户端会忽略
+var keepAliveComment = []byte(": keep-alive\n\n")
+
+// TimeoutSettings 流式请求的超时设置，可以在model_configs中按模型覆盖
+type TimeoutSettings struct {
+	Connect    time.Duration `yaml:"connect"`     // 建立连接的超时，超时后切换到下一个后端
+	FirstToken time.Duration `yaml:"first_token"` // 发送请求后等待第一段输出的超时，包括模型加载时间
+	Idle       time.Duration `yaml:"idle"`        // 两段输出之间的最长间隔
+	KeepAlive  time.Duration `yaml:"keep_alive"`  // 等待第一段输出时向客户端发送SSE注释的间隔，避免代理断开空闲连接，0表示不发送
+}
+
+// merge 用override中不为0的设置覆盖当前设置
+func (t TimeoutSettings) merge(override TimeoutSettings) TimeoutSettings {
+	if override.Connect > 0 {
+		t.Connect = override.Connect
+	}
+	if override.FirstToken > 0 {
+		t.FirstToken = override.FirstToken
+	}
+	if override.Idle > 0 {
+		t.Idle = override.Idle
+	}
+	if override.KeepAlive > 0 {
+		t.KeepAlive = override.KeepAlive
+	}
+	return t
+}
+
+// ResolveTimeouts 返回模型的流式请求超时设置，模型配置覆盖全局配置
+func (s LLMSettings) ResolveTimeouts(model string) TimeoutSettings {
+	return s.Timeouts.merge(s.ModelConfigs[model].Timeouts)
+}
+
+// validateTimeouts 校验超时设置，prefix为配置项的路径
+func validateTimeouts(prefix string, t TimeoutSettings) error {
+	if t.Connect < 0 || t.FirstToken < 0 || t.Idle < 0 || t.KeepAlive < 0 {
+		return fmt.Errorf("%s中的超时时间不能为负数", prefix)
+	}
+	return nil
+}
+
+// connectTimeoutKey 请求上下文中连接超时的键，由共享的Transport在建立连接时读取
+type connectTimeoutKey struct{}
+
+// withConnectTimeout 在请求上下文中设置建立连接的超时
+func withConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// llmTransport 模型请求共享的Transport，按请求上下文中的设置限制建立连接的时间
+var llmTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration)
+		if !ok || timeout <= 0 {
+			timeout = defaultConnectTimeout
+		}
+		dialer := net.Dialer{Timeout: timeout, KeepAlive: time.Second * 30}
+		return dialer.DialContext(ctx, network, addr)
+	},
+	ForceAttemptHTTP2:   true,
+	MaxIdleConns:        100,
+	IdleConnTimeout:     time.Second * 90,
+	TLSHandshakeTimeout: time.Second * 10,
+}
+
+// errStreamTimeout 等待模型输出超时，用于区分超时和其他原因导致的请求取消
+var errStreamTimeout = errors.New("等待模型输出超时")
+
+// streamWatchdog 监控流式请求，在等待第一段输出或两段输出之间超时时取消请求
+// 等待第一段输出期间定期向客户端发送SSE注释
+type streamWatchdog struct {
+	timeouts TimeoutSettings
+	cancel   context.CancelCauseFunc
+	timer    *time.Timer
+	received bool // 是否已收到第一段输出
+
+	stopAlive chan struct{} // 关闭时停止发送SSE注释
+	aliveDone chan struct{} // 发送SSE注释的协程退出后关闭
+}
+
+// newStreamWatchdog 创建监控并开始等待第一段输出，w不为空时发送SSE注释
+func newStreamWatchdog(ctx context.Context, timeouts TimeoutSettings, w io.Writer) (context.Context, *streamWatchdog) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	d := &streamWatchdog{timeouts: timeouts, cancel: cancel}
+	if timeouts.FirstToken > 0 {
+		d.timer = time.AfterFunc(timeouts.FirstToken, d.expire)
+	}
+	if w != nil && timeouts.KeepAlive > 0 {
+		d.stopAlive = make(chan struct{})
+		d.aliveDone = make(chan struct{})
+		go d.keepAlive(w)
+	}
+	return ctx, d
+}
+
+// expire 超时时取消请求
+func (d *streamWatchdog) expire() {
+	d.cancel(errStreamTimeout)
+}
+
+// keepAlive 定期向客户端发送SSE注释，直到收到第一段输出
+func (d *streamWatchdog) keepAlive(w io.Writer) {
+	defer close(d.aliveDone)
+	ticker := time.NewTicker(d.timeouts.KeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopAlive:
+			return
+		case <-ticker.C:
+			if _, err := w.Write(keepAliveComment); err != nil {
+				return
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+	}
+}
+
+// stopKeepAlive 停止发送SSE注释，返回后不会再有并发的写入
+func (d *streamWatchdog) stopKeepAlive() {
+	if d.stopAlive == nil {
+		return
+	}
+	close(d.stopAlive)
+	<-d.aliveDone
+	d.stopAlive = nil
+}
+
+// observe 收到一段输出，停止发送SSE注释并重新开始计算输出间隔
+// 必须在把输出写入客户端之前调用
+func (d *streamWatchdog) observe() {
+	first := !d.received
+	d.received = true
+	if first {
+		d.stopKeepAlive()
+	}
+	if d.timer == nil && d.timeouts.Idle > 0 {
+		d.timer = time.AfterFunc(d.timeouts.Idle, d.expire)
+		return
+	}
+	if d.timer != nil {
+		if d.timeouts.Idle > 0 {
+			d.timer.Reset(d.timeouts.Idle)
+		} else {
+			d.timer.Stop()
+		}
+	}
+}
+
+// err 请求因超时被取消时返回分类后的超时错误，否则返回nil
+func (d *streamWatchdog) err(ctx context.Context, backend string) error {
+	if !errors.Is(context.Cause(ctx), errStreamTimeout) {
+		return nil
+	}
+	message := fmt.Sprintf("等待模型首个token超时: %s", d.timeouts.FirstToken)
+	if d.received {
+		message = fmt.Sprintf("模型输出间隔超时: %s", d.timeouts.Idle)
+	}
+	return &UpstreamError{Kind: UpstreamTimeout, Backend: backend, Message: message, Err: context.DeadlineExceeded}
+}
+
+// stop 停止监控，释放定时器和发送SSE注释的协程
+func (d *streamWatchdog) stop() {
+	d.stopKeepAlive()
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.cancel(nil)
+}
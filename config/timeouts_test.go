@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer 可以并发写入的缓冲区，用于接收SSE注释
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitDone 等待请求被取消，超过wait仍未取消时返回false
+func waitDone(ctx context.Context, wait time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(wait):
+		return false
+	}
+}
+
+func TestStreamWatchdog(t *testing.T) {
+	timeouts := TimeoutSettings{FirstToken: time.Millisecond * 50, Idle: time.Millisecond * 150}
+
+	tests := []struct {
+		name    string
+		run     func(d *streamWatchdog) // 模拟收到的输出
+		timeout bool                    // 是否应超时
+		message string                  // 超时错误应包含的内容
+	}{
+		{
+			name:    "等待首个token超时",
+			run:     func(d *streamWatchdog) {},
+			timeout: true,
+			message: "首个token",
+		},
+		{
+			name: "输出间隔超时",
+			run: func(d *streamWatchdog) {
+				d.observe()
+			},
+			timeout: true,
+			message: "输出间隔",
+		},
+		{
+			name: "持续输出时首个token超时不再生效",
+			run: func(d *streamWatchdog) {
+				for i := 0; i < 5; i++ {
+					d.observe()
+					time.Sleep(time.Millisecond * 30)
+				}
+				d.stop()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, watchdog := newStreamWatchdog(context.Background(), timeouts, nil)
+			defer watchdog.stop()
+			tt.run(watchdog)
+
+			if !waitDone(ctx, time.Second) {
+				t.Fatal("请求未被取消")
+			}
+			err := watchdog.err(ctx, "test")
+			if !tt.timeout {
+				if err != nil {
+					t.Fatalf("err() = %v, 期望nil", err)
+				}
+				return
+			}
+
+			var upstream *UpstreamError
+			if !errors.As(err, &upstream) || upstream.Kind != UpstreamTimeout || upstream.Backend != "test" {
+				t.Fatalf("err() = %v, 期望超时错误", err)
+			}
+			if !strings.Contains(upstream.Message, tt.message) {
+				t.Errorf("Message = %q, 应包含 %q", upstream.Message, tt.message)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Error("超时错误应能展开为context.DeadlineExceeded")
+			}
+		})
+	}
+}
+
+func TestStreamWatchdogFirstTokenLongerThanIdle(t *testing.T) {
+	// 首个token的超时远大于输出间隔，等待首个token期间不应按输出间隔超时
+	ctx, watchdog := newStreamWatchdog(context.Background(), TimeoutSettings{FirstToken: time.Millisecond * 300, Idle: time.Millisecond * 20}, nil)
+	defer watchdog.stop()
+
+	if waitDone(ctx, time.Millisecond*100) {
+		t.Fatal("等待首个token期间按输出间隔超时")
+	}
+	watchdog.observe()
+	if !waitDone(ctx, time.Second) {
+		t.Fatal("收到输出后未按输出间隔超时")
+	}
+	if err := watchdog.err(ctx, ""); err == nil || !strings.Contains(err.Error(), "输出间隔") {
+		t.Errorf("err() = %v, 期望输出间隔超时", err)
+	}
+}
+
+func TestStreamWatchdogKeepAlive(t *testing.T) {
+	var buf lockedBuffer
+	_, watchdog := newStreamWatchdog(context.Background(), TimeoutSettings{KeepAlive: time.Millisecond * 10}, &buf)
+	time.Sleep(time.Millisecond * 50)
+	watchdog.observe()
+	sent := buf.String()
+	if !strings.HasPrefix(sent, string(keepAliveComment)) {
+		t.Fatalf("等待首个token期间应发送SSE注释，实际为 %q", sent)
+	}
+
+	// 收到第一段输出后不再发送
+	time.Sleep(time.Millisecond * 50)
+	if buf.String() != sent {
+		t.Error("收到输出后仍在发送SSE注释")
+	}
+	watchdog.stop()
+}
+
+func TestStreamWatchdogNoTimeouts(t *testing.T) {
+	// 超时为0表示不限制
+	ctx, watchdog := newStreamWatchdog(context.Background(), TimeoutSettings{}, nil)
+	watchdog.observe()
+	if waitDone(ctx, time.Millisecond*50) {
+		t.Fatal("未设置超时时请求不应被取消")
+	}
+	watchdog.stop()
+	if err := watchdog.err(ctx, ""); err != nil {
+		t.Errorf("正常结束时err() = %v", err)
+	}
+}
+
+func TestResolveTimeouts(t *testing.T) {
+	settings := LLMSettings{
+		Timeouts: TimeoutSettings{Connect: time.Second, FirstToken: time.Minute, Idle: time.Second * 30, KeepAlive: time.Second * 15},
+		ModelConfigs: map[string]ModelConfig{
+			"deepseek-r1:70b": {Timeouts: TimeoutSettings{FirstToken: time.Minute * 10}},
+		},
+	}
+	got := settings.ResolveTimeouts("deepseek-r1:70b")
+	want := TimeoutSettings{Connect: time.Second, FirstToken: time.Minute * 10, Idle: time.Second * 30, KeepAlive: time.Second * 15}
+	if got != want {
+		t.Errorf("ResolveTimeouts() = %+v, 期望 %+v", got, want)
+	}
+	if got := settings.ResolveTimeouts("llama3"); got != settings.Timeouts {
+		t.Errorf("未单独配置的模型应使用全局设置，实际为 %+v", got)
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import "errors"
+
+// ToolSettings 工具调用配置
+type ToolSettings struct {
+	Enabled   []string `yaml:"enabled"`    // 允许使用的内置工具，为空表示全部允许
+	MaxRounds int      `yaml:"max_rounds"` // 单次请求最多执行的工具调用轮数
+}
+
+// ToolAllowed 判断工具是否允许使用
+func (s ToolSettings) ToolAllowed(name string) bool {
+	if len(s.Enabled) == 0 {
+		return true
+	}
+	for _, n := range s.Enabled {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateToolSettings 校验工具调用配置
+func validateToolSettings(settings ToolSettings) error {
+	if settings.MaxRounds <= 0 {
+		return errors.New("tools.max_rounds必须大于0")
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// 链路追踪导出方式
+const (
+	TracingExporterOTLP   = "otlp"   // 通过OTLP/HTTP导出到Collector
+	TracingExporterStdout = "stdout" // 输出到标准输出，用于本地调试
+)
+
+// tracerName 服务内创建span使用的Tracer名称
+const tracerName = "github.com/trae-ds-go-backend"
+
+// tracer 模型请求使用的Tracer，未启用链路追踪时为空实现
+var tracer = otel.Tracer(tracerName)
+
+// TracingConfig 链路追踪配置，热加载时不会更新
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled"`      // 是否启用链路追踪
+	Exporter    string  `yaml:"exporter"`     // 导出方式：otlp、stdout
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP地址，如localhost:4318，为空时使用OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool    `yaml:"insecure"`     // OTLP是否使用HTTP而不是HTTPS
+	ServiceName string  `yaml:"service_name"` // 上报的服务名称
+	SampleRatio float64 `yaml:"sample_ratio"` // 采样比例，0到1之间，上游请求带有采样标记时沿用上游的决定
+}
+
+// SetupTracing 根据配置初始化全局的TracerProvider和traceparent传播，返回关闭时刷新数据的函数
+// 未启用时只设置传播器，不导出任何数据
+func SetupTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		options := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("创建链路追踪导出器失败: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("创建链路追踪资源失败: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// validateTracingConfig 校验链路追踪配置
+func validateTracingConfig(cfg TracingConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	switch cfg.Exporter {
+	case TracingExporterOTLP, TracingExporterStdout:
+	default:
+		return fmt.Errorf("无效的链路追踪导出方式: %s", cfg.Exporter)
+	}
+	if cfg.ServiceName == "" {
+		return errors.New("tracing.service_name不能为空")
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return errors.New("tracing.sample_ratio必须在0到1之间")
+	}
+	return nil
+}
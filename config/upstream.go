@@ -0,0 +1,111 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// UpstreamKind 模型后端错误的分类，客户端据此给出不同的提示
+type UpstreamKind string
+
+// 模型后端错误分类
+const (
+	UpstreamUnavailable     UpstreamKind = "unavailable"      // 后端连接失败或没有可用的后端
+	UpstreamModelNotFound   UpstreamKind = "model_not_found"  // 后端没有该模型
+	UpstreamOutOfMemory     UpstreamKind = "out_of_memory"    // 显存或内存不足，模型无法加载或运行中崩溃
+	UpstreamTimeout         UpstreamKind = "timeout"          // 请求超时
+	UpstreamContextOverflow UpstreamKind = "context_overflow" // 提示词超过模型的上下文窗口
+	UpstreamUnknown         UpstreamKind = "unknown"          // 其他错误
+)
+
+// upstreamPatterns 按Ollama和llama.cpp的错误信息识别错误分类，按顺序匹配
+var upstreamPatterns = []struct {
+	kind     UpstreamKind
+	keywords []string
+}{
+	{UpstreamContextOverflow, []string{"context length", "context window", "exceeds the context", "context size", "input length exceeds", "too many tokens"}},
+	{UpstreamOutOfMemory, []string{"out of memory", "requires more system memory", "resource limitations", "insufficient memory", "cudamalloc failed"}},
+	{UpstreamModelNotFound, []string{"not found, try pulling", "model not found", "no such model"}},
+	{UpstreamTimeout, []string{"timeout", "timed out", "deadline exceeded"}},
+	{UpstreamUnavailable, []string{"connection refused", "no route to host", "connection reset"}},
+}
+
+// UpstreamError 模型后端返回的错误或请求后端时发生的错误
+type UpstreamError struct {
+	Kind       UpstreamKind
+	Backend    string // 出错的后端名称，所有后端均不可用时为空
+	StatusCode int    // 后端返回的HTTP状态码，连接失败或生成过程中出错时为0
+	Message    string // 错误描述，包含后端返回的原始错误信息
+	Err        error  // 底层错误
+}
+
+// Error 实现error接口
+func (e *UpstreamError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap 返回底层错误
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// classifyUpstream 根据HTTP状态码、错误信息和底层错误判断错误分类
+func classifyUpstream(statusCode int, message string, err error) UpstreamKind {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return UpstreamTimeout
+	}
+	if err != nil {
+		message += " " + err.Error()
+	}
+	message = strings.ToLower(message)
+	for _, pattern := range upstreamPatterns {
+		for _, keyword := range pattern.keywords {
+			if strings.Contains(message, keyword) {
+				return pattern.kind
+			}
+		}
+	}
+	if statusCode == http.StatusNotFound {
+		return UpstreamModelNotFound
+	}
+	return UpstreamUnknown
+}
+
+// upstreamStatusError 读取后端返回的非200响应，解析其中的错误信息
+func upstreamStatusError(backend string, resp *http.Response) *UpstreamError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.TrimSpace(string(body))
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != "" {
+		message = payload.Error
+	}
+	return &UpstreamError{
+		Kind:       classifyUpstream(resp.StatusCode, message, nil),
+		Backend:    backend,
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, message),
+	}
+}
+
+// streamLineError 解析流式响应中的一行，Ollama在生成过程中出错时返回只包含error字段的一行
+func streamLineError(line []byte) string {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(line, &payload) != nil {
+		return ""
+	}
+	return payload.Error
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyUpstream(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		message    string
+		err        error
+		want       UpstreamKind
+	}{
+		{"连接被拒绝", 0, "", fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED), UpstreamUnavailable},
+		{"请求超时", 0, "", context.DeadlineExceeded, UpstreamTimeout},
+		{"Ollama模型不存在", http.StatusNotFound, `model "llama9" not found, try pulling it first`, nil, UpstreamModelNotFound},
+		{"未知的404", http.StatusNotFound, "404 page not found", nil, UpstreamModelNotFound},
+		{"模型加载内存不足", http.StatusInternalServerError, "model requires more system memory (12.0 GiB) than is available (8.0 GiB)", nil, UpstreamOutOfMemory},
+		{"CUDA显存不足", 0, "CUDA error: out of memory", nil, UpstreamOutOfMemory},
+		{"超过上下文窗口", http.StatusBadRequest, "the input length exceeds the context length", nil, UpstreamContextOverflow},
+		{"其他5xx错误", http.StatusInternalServerError, "llama runner process has terminated", nil, UpstreamUnknown},
+		{"网关错误", http.StatusBadGateway, "", nil, UpstreamUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyUpstream(tt.statusCode, tt.message, tt.err); got != tt.want {
+				t.Errorf("classifyUpstream() = %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamStatusError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       UpstreamKind
+		message    string
+	}{
+		{"解析JSON错误信息", http.StatusNotFound, `{"error":"model \"llama9\" not found, try pulling it first"}`, UpstreamModelNotFound, "not found, try pulling"},
+		{"非JSON响应", http.StatusServiceUnavailable, "upstream connect error\n", UpstreamUnknown, "upstream connect error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.statusCode, Body: io.NopCloser(strings.NewReader(tt.body))}
+			err := upstreamStatusError("gpu-1", resp)
+			if err.Kind != tt.want || err.StatusCode != tt.statusCode || err.Backend != "gpu-1" {
+				t.Errorf("upstreamStatusError() = %+v", err)
+			}
+			if !strings.Contains(err.Message, tt.message) {
+				t.Errorf("Message = %q, 应包含 %q", err.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestStreamLineError(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"错误行", `{"error":"CUDA error: out of memory"}` + "\n", "CUDA error: out of memory"},
+		{"正常的内容行", `{"message":{"role":"assistant","content":"你好"},"done":false}` + "\n", ""},
+		{"非JSON", "data: [DONE]\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := streamLineError([]byte(tt.line)); got != tt.want {
+				t.Errorf("streamLineError() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamErrorUnwrap(t *testing.T) {
+	err := &UpstreamError{Kind: UpstreamTimeout, Message: "等待模型首个token超时", Err: context.DeadlineExceeded}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("UpstreamError应能展开到底层错误")
+	}
+	if err.Error() != "等待模型首个token超时: context deadline exceeded" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestNewLLMClientInvalidBackends(t *testing.T) {
+	// 后端配置无效时不应返回nil后端池，模型请求返回ErrNoBackend
+	client := NewLLMClient(LLMSettings{Backends: []Backend{{Name: "broken"}}})
+	if client.Pool == nil {
+		t.Fatal("后端池不应为nil")
+	}
+	if statuses := client.Pool.Status(); len(statuses) != 0 {
+		t.Errorf("Status() = %v, 期望空列表", statuses)
+	}
+
+	_, err := client.Chat([]Message{{Role: "user", Content: "你好"}}, nil, "llama3", ChatParams{})
+	var upstream *UpstreamError
+	if !errors.As(err, &upstream) || upstream.Kind != UpstreamUnavailable || !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Chat() error = %v, 期望ErrNoBackend", err)
+	}
+}
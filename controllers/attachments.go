@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// attachmentResponse 构建附件的响应数据
+func attachmentResponse(attachment *models.Attachment) gin.H {
+	return gin.H{
+		"id":         attachment.ID,
+		"filename":   attachment.Filename,
+		"mime_type":  attachment.MimeType,
+		"size":       attachment.Size,
+		"created_at": attachment.CreatedAt,
+	}
+}
+
+// UploadAttachment 上传附件，按文件内容识别MIME类型并检查大小
+func UploadAttachment(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+	storage := middleware.GetConfig(c).Storage
+
+	// 读取上传的文件
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		apperr.Respond(c, apperr.ErrFileRequired)
+		return
+	}
+	if fileHeader.Size > storage.MaxSize {
+		apperr.Respond(c, apperr.ErrFileTooLarge.With(storage.MaxSize))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		apperr.Respond(c, apperr.ErrReadFile.Wrap(err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, storage.MaxSize+1))
+	if err != nil || int64(len(data)) > storage.MaxSize {
+		apperr.Respond(c, apperr.ErrReadFile.Wrap(err))
+		return
+	}
+
+	// 不信任客户端提供的Content-Type，按文件内容识别
+	mimeType := strings.TrimSpace(strings.Split(http.DetectContentType(data), ";")[0])
+	if !storage.TypeAllowed(mimeType) {
+		apperr.Respond(c, apperr.ErrUnsupportedType.With(mimeType))
+		return
+	}
+
+	// 保存到用户目录，文件名使用随机ID
+	relPath := filepath.Join(strconv.FormatUint(uint64(userID), 10), uuid.New().String()+strings.ToLower(filepath.Ext(fileHeader.Filename)))
+	fullPath := filepath.Join(storage.Dir, relPath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceAttachment, err))
+		return
+	}
+	if err := os.WriteFile(fullPath, data, 0o644); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceAttachment, err))
+		return
+	}
+
+	attachment := models.Attachment{
+		UserID:   userID,
+		Filename: filepath.Base(fileHeader.Filename),
+		MimeType: mimeType,
+		Size:     int64(len(data)),
+		Path:     relPath,
+	}
+	if err := models.DB.Create(&attachment).Error; err != nil {
+		os.Remove(fullPath)
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceAttachment, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "附件上传成功", "attachment": attachmentResponse(&attachment)})
+}
+
+// ListAttachments 获取当前用户的附件列表
+func ListAttachments(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	attachments, err := models.GetAttachmentsByUserID(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceAttachment, err))
+		return
+	}
+
+	responseAttachments := make([]gin.H, 0, len(attachments))
+	for i := range attachments {
+		responseAttachments = append(responseAttachments, attachmentResponse(&attachments[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": responseAttachments})
+}
+
+// GetAttachment 下载附件内容，用于在历史记录中显示
+func GetAttachment(c *gin.Context) {
+	attachment, ok := loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", attachment.MimeType)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.Filename))
+	c.File(filepath.Join(middleware.GetConfig(c).Storage.Dir, attachment.Path))
+}
+
+// DeleteAttachment 删除附件及其文件
+func DeleteAttachment(c *gin.Context) {
+	attachment, ok := loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteAttachment(attachment.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceAttachment, err))
+		return
+	}
+	os.Remove(filepath.Join(middleware.GetConfig(c).Storage.Dir, attachment.Path))
+
+	c.JSON(http.StatusOK, gin.H{"message": "附件删除成功"})
+}
+
+// loadAttachment 根据路径参数加载附件，只有上传者可以访问
+func loadAttachment(c *gin.Context) (*models.Attachment, bool) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
+	}
+
+	// 获取附件ID
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceAttachment))
+		return nil, false
+	}
+
+	attachment, err := models.GetAttachmentByID(uint(attachmentID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceAttachment))
+		return nil, false
+	}
+	if attachment.UserID != userID {
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceAttachment))
+		return nil, false
+	}
+
+	return attachment, true
+}
+
+// resolveAttachments 将消息引用的附件转换为发送给模型的内容
+// 图片转换为base64放入images，文本和PDF提取文本后附加到消息内容中
+func resolveAttachments(messages []config.Message, userID uint, storage config.StorageConfig) error {
+	for i := range messages {
+		message := &messages[i]
+		if len(message.Images) > 0 {
+			return apperr.ErrInlineImages
+		}
+
+		for _, id := range message.Attachments {
+			attachment, err := models.GetAttachmentByID(id)
+			if err != nil {
+				return apperr.NotFound(apperr.ResourceAttachment).WithDetail(fmt.Sprint(id))
+			}
+			if attachment.UserID != userID {
+				return apperr.Forbidden(apperr.ResourceAttachment).WithDetail(fmt.Sprint(id))
+			}
+			data, err := os.ReadFile(filepath.Join(storage.Dir, attachment.Path))
+			if err != nil {
+				return apperr.Failed(apperr.OpGet, apperr.ResourceAttachment, err)
+			}
+
+			if attachment.IsImage() {
+				message.Images = append(message.Images, base64.StdEncoding.EncodeToString(data))
+				continue
+			}
+			text, err := extractAttachmentText(attachment, data)
+			if err != nil {
+				return err
+			}
+			message.Content += fmt.Sprintf("\n\n附件 %s：\n%s", attachment.Filename, text)
+		}
+		message.Attachments = nil
+	}
+	return nil
+}
+
+// extractAttachmentText 提取非图片附件的文本
+func extractAttachmentText(attachment *models.Attachment, data []byte) (string, error) {
+	if attachment.MimeType == "application/pdf" {
+		return documentText(".pdf", data)
+	}
+	if strings.HasPrefix(attachment.MimeType, "text/") {
+		return documentText(".txt", data)
+	}
+	return "", apperr.ErrAttachmentNotText.With(attachment.Filename)
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// 审计日志查询的分页大小
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// auditResult 一次模型调用的结果，用于记录审计日志
+type auditResult struct {
+	Completion    string
+	HistoryID     string
+	Usage         config.Usage
+	ModelDuration int64 // 单位纳秒
+	Err           error
+}
+
+// recordAudit 记录一次聊天请求的审计日志，记录失败不影响请求
+func recordAudit(c *gin.Context, req *chatRequest, started time.Time, result auditResult) {
+	audit := req.Config.Audit
+	if !audit.Enabled {
+		return
+	}
+
+	// 请求哈希基于实际发送给模型的内容计算，不受脱敏影响
+	promptJSON, _ := json.Marshal(req.Messages)
+	requestJSON, _ := json.Marshal(gin.H{"model": req.Input.Model, "messages": req.Messages, "options": req.Options})
+	hash := sha256.Sum256(requestJSON)
+
+	log := models.AuditLog{
+		UserID:           req.UserID,
+		Endpoint:         c.FullPath(),
+		ModelName:        req.Input.Model,
+		HistoryID:        result.HistoryID,
+		RequestHash:      hex.EncodeToString(hash[:]),
+		ClientIP:         c.ClientIP(),
+		Status:           models.AuditStatusSuccess,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		ModelDurationMs:  result.ModelDuration / int64(time.Millisecond),
+		DurationMs:       time.Since(started).Milliseconds(),
+	}
+	if audit.StoreContent {
+		log.Prompt = audit.Redact(string(promptJSON))
+		log.Completion = audit.Redact(result.Completion)
+	}
+	switch {
+	case result.Err != nil:
+		log.Status = models.AuditStatusError
+		log.Error = result.Err.Error()
+	case c.Request.Context().Err() != nil:
+		log.Status = models.AuditStatusCanceled
+	}
+
+	if err := models.CreateAuditLog(req.TraceContext, &log); err != nil {
+		req.Logger.Error("记录审计日志失败", "error", err)
+	}
+}
+
+// ListAuditLogs 按用户、模型、结果和时间范围分页查询审计日志，仅管理员可用
+func ListAuditLogs(c *gin.Context) {
+	var filter models.AuditLogFilter
+	if v := c.Query("user_id"); v != "" {
+		userID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			apperr.Respond(c, apperr.InvalidID(apperr.ResourceUser))
+			return
+		}
+		filter.UserID = uint(userID)
+	}
+	filter.Model = c.Query("model")
+	filter.Status = c.Query("status")
+
+	var err error
+	if filter.From, err = parseAuditTime(c.Query("from"), false); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidStartTime)
+		return
+	}
+	if filter.To, err = parseAuditTime(c.Query("to"), true); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidEndTime)
+		return
+	}
+
+	// 分页参数
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		apperr.Respond(c, apperr.ErrInvalidPage)
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxAuditPageSize {
+		apperr.Respond(c, apperr.ErrPageSize.With(maxAuditPageSize))
+		return
+	}
+
+	logs, total, err := models.QueryAuditLogs(filter, (page-1)*pageSize, pageSize)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceAuditLog, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetAuditLog 获取审计日志详情，包括提示词和回复内容，仅管理员可用
+func GetAuditLog(c *gin.Context) {
+	logID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceAuditLog))
+		return
+	}
+
+	log, err := models.GetAuditLogByID(uint(logID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceAuditLog))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"log": log})
+}
+
+// parseAuditTime 解析RFC3339时间或日期，只有日期的结束时间包含当天
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
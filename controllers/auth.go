@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
 	"github.com/trae-ds-go-backend/middleware"
 	"github.com/trae-ds-go-backend/models"
 )
@@ -27,21 +28,21 @@ func Register(c *gin.Context) {
 
 	// 绑定请求数据
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		apperr.Respond(c, apperr.ErrInvalidRequest)
 		return
 	}
 
 	// 检查用户名是否已存在
 	_, err := models.FindUserByUsername(input.Username)
 	if err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在"})
+		apperr.Respond(c, apperr.ErrUsernameTaken)
 		return
 	}
 
 	// 检查邮箱是否已存在
 	_, err = models.FindUserByEmail(input.Email)
 	if err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已被注册"})
+		apperr.Respond(c, apperr.ErrEmailTaken)
 		return
 	}
 
@@ -53,21 +54,21 @@ func Register(c *gin.Context) {
 
 	// 哈希密码
 	if err := user.HashPassword(input.Password); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 
 	// 保存用户到数据库
 	result := models.DB.Create(&user)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户创建失败"})
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceUser, result.Error))
 		return
 	}
 
 	// 生成JWT令牌
-	token, err := middleware.GenerateToken(&user)
+	token, err := middleware.GenerateToken(&user, middleware.GetConfig(c).Auth)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "令牌生成失败"})
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 
@@ -89,27 +90,27 @@ func Login(c *gin.Context) {
 
 	// 绑定请求数据
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		apperr.Respond(c, apperr.ErrInvalidRequest)
 		return
 	}
 
 	// 查找用户
 	user, err := models.FindUserByUsername(input.Username)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		apperr.Respond(c, apperr.ErrInvalidCredentials)
 		return
 	}
 
 	// 验证密码
 	if err := user.CheckPassword(input.Password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		apperr.Respond(c, apperr.ErrInvalidCredentials)
 		return
 	}
 
 	// 生成JWT令牌
-	token, err := middleware.GenerateToken(user)
+	token, err := middleware.GenerateToken(user, middleware.GetConfig(c).Auth)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "令牌生成失败"})
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 
@@ -123,4 +124,4 @@ func Login(c *gin.Context) {
 		},
 		"token": token,
 	})
-}
\ No newline at end of file
+}
@@ -1,175 +1,664 @@
 package controllers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/trae-ds-go-backend/apperr"
 	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
 	"github.com/trae-ds-go-backend/models"
 )
 
 // ChatInput 聊天请求结构
 type ChatInput struct {
-	Messages  []config.Message       `json:"messages" binding:"required"`
-	Model     string                 `json:"model" binding:"required"`
+	Messages  []config.Message       `json:"messages"` // 使用模板时可以为空
+	Model     string                 `json:"model"`    // 模型名称，为空时使用配置的默认模型
 	Options   map[string]interface{} `json:"options"`
 	HistoryID string                 `json:"history_id"` // 聊天历史ID，可选参数
+
+	KeepReasoning bool `json:"keep_reasoning"` // 是否将历史回复中的推理内容发送给模型，默认去掉
+	PresetID      uint `json:"preset_id"`      // 提示词预设ID，可选参数
+
+	ContextStrategy string `json:"context_strategy"` // 上下文截断策略，为空时使用配置的默认策略
+
+	TemplateID uint                   `json:"template_id"` // 提示词模板ID，渲染结果作为最后一条用户消息
+	Variables  map[string]interface{} `json:"variables"`   // 模板变量
+
+	KnowledgeBaseIDs []uint `json:"knowledge_base_ids"` // 检索的知识库ID，检索结果作为参考资料加入提示词
+
+	Tools []string `json:"tools"` // 启用的内置工具名称，仅支持流式聊天
+
+	Format        json.RawMessage `json:"format"`         // 结构化输出："json"或JSON Schema对象
+	FormatRetries int             `json:"format_retries"` // 输出不符合格式时的重试次数
 }
 
-// StreamChat 处理流式聊天请求
-func StreamChat(c *gin.Context) {
+// chatRequest 已校验的聊天请求
+type chatRequest struct {
+	UserID   uint
+	Input    ChatInput
+	Config   *config.AppConfig
+	Messages []config.Message       // 实际发送给模型的消息，Input.Messages保持原样用于保存历史
+	Options  map[string]interface{} // 合并用户偏好后的请求参数
+	Preset   *models.PromptPreset   // 使用的提示词预设，可为空
+	Context  config.ContextReport   // 上下文截断结果
+
+	Citations []config.Citation // 加入提示词的知识库分块
+
+	Tools        []config.ToolDefinition // 可供模型调用的工具
+	ToolMessages []config.Message        // 工具调用过程中产生的assistant和tool消息，保存到历史记录
+	Format       *config.OutputFormat    // 结构化输出格式，可为空
+
+	CompareGroupID  string // 对比模式的分组ID，不为空时总是创建新的历史记录
+	CompareParentID string // 发起对比时所在的聊天历史ID
+
+	Logger       *slog.Logger    // 带有请求ID和用户ID的日志记录器
+	TraceContext context.Context // 带有请求span的上下文，不会随客户端断开而取消，保证断开后仍能保存历史
+}
+
+// params 返回发送给模型的可选参数
+func (r *chatRequest) params() config.ChatParams {
+	params := config.ChatParams{Tools: r.Tools}
+	if r.Format != nil {
+		params.Format = r.Format.Raw
+	}
+	return params
+}
+
+// presetID 返回使用的预设ID，未使用预设时返回nil
+func (r *chatRequest) presetID() *uint {
+	if r.Preset == nil {
+		return nil
+	}
+	id := r.Preset.ID
+	return &id
+}
+
+// bindChatRequest 获取用户ID、绑定并校验聊天请求，失败时直接写入错误响应
+func bindChatRequest(c *gin.Context) (*chatRequest, bool) {
 	// 获取用户ID
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
-		return
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
 	}
 	userID, ok := userIDInterface.(uint)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户ID类型错误"})
-		return
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
 	}
 
 	// 绑定请求数据
 	var input ChatInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return nil, false
+	}
+	return buildChatRequest(c, userID, input)
+}
+
+// buildChatRequest 校验聊天请求并构建发送给模型的提示词，失败时直接写入错误响应
+func buildChatRequest(c *gin.Context, userID uint, input ChatInput) (*chatRequest, bool) {
+	// 渲染提示词模板，作为最后一条用户消息
+	if input.TemplateID != 0 {
+		tmpl, err := models.GetPromptTemplateByID(input.TemplateID)
+		if err != nil {
+			apperr.Respond(c, apperr.NotFound(apperr.ResourceTemplate))
+			return nil, false
+		}
+		if !tmpl.CanAccess(userID) {
+			apperr.Respond(c, apperr.Forbidden(apperr.ResourceTemplate))
+			return nil, false
+		}
+		content, err := tmpl.Render(input.Variables)
+		if err != nil {
+			apperr.Respond(c, apperr.ErrRenderTemplate.WithDetail(err.Error()))
+			return nil, false
+		}
+		input.Messages = append(input.Messages, config.Message{Role: "user", Content: content})
+	}
+	if len(input.Messages) == 0 {
+		apperr.Respond(c, apperr.ErrEmptyMessages)
+		return nil, false
+	}
+
+	// 加载提示词预设，请求未指定模型时使用预设的默认模型
+	var preset *models.PromptPreset
+	var presetOptions map[string]interface{}
+	if input.PresetID != 0 {
+		var err error
+		preset, err = models.GetPromptPresetByID(input.PresetID)
+		if err != nil {
+			apperr.Respond(c, apperr.NotFound(apperr.ResourcePreset))
+			return nil, false
+		}
+		if !preset.CanAccess(userID) {
+			apperr.Respond(c, apperr.Forbidden(apperr.ResourcePreset))
+			return nil, false
+		}
+		if input.Model == "" {
+			input.Model = preset.DefaultModel
+		}
+		presetOptions, _ = preset.GetOptions()
+	}
+
+	// 校验模型和请求限制
+	cfg := middleware.GetConfig(c)
+	if err := validateChatInput(&input, cfg.LLM); err != nil {
+		apperr.Respond(c, err)
+		return nil, false
+	}
+	toolDefinitions, err := resolveTools(input.Tools, cfg.LLM.Tools)
+	if err != nil {
+		apperr.Respond(c, err)
+		return nil, false
+	}
+	format, err := config.ParseOutputFormat(input.Format)
+	if err != nil {
+		apperr.Respond(c, apperr.ErrInvalidFormat.WithDetail(err.Error()).Wrap(errors.Unwrap(err)))
+		return nil, false
+	}
+
+	// 合并用户偏好、预设参数和请求参数，服务器默认值和上限由LLM客户端应用
+	options := config.MergeOptions(userPreferences(userID), presetOptions, input.Options)
+
+	// 去掉历史回复中的推理内容，并将附件转换为图片或文本
+	prompt := newPromptBuilder(config.StripReasoning(input.Messages, input.KeepReasoning))
+	if err := resolveAttachments(prompt.messages, userID, cfg.Storage); err != nil {
+		apperr.Respond(c, err)
+		return nil, false
+	}
+
+	// 用已保存的对话摘要替换较早的消息
+	summarized := 0
+	if history := ownedHistory(input.HistoryID, userID); history != nil {
+		summarized = applyHistorySummary(prompt, history, input.Messages)
+	}
+
+	// 检索知识库，将最相关的分块作为系统消息加入提示词
+	var citations []config.Citation
+	if query := lastUserMessage(input.Messages); len(input.KnowledgeBaseIDs) > 0 && query != "" {
+		kbs, err := loadChatKnowledgeBases(userID, input.KnowledgeBaseIDs)
+		if err != nil {
+			apperr.Respond(c, err)
+			return nil, false
+		}
+		citations, err = retrieveCitations(c.Request.Context(), cfg.LLM, kbs, query)
+		if err != nil {
+			apperr.Respond(c, apperr.ErrKnowledgeSearch.Wrap(err))
+			return nil, false
+		}
+		if len(citations) > 0 {
+			prompt.prepend(config.KnowledgePrompt(citations))
+		}
+	}
+
+	// 在最前面加入预设的系统提示词
+	if preset != nil && preset.SystemPrompt != "" {
+		prompt.prepend(config.Message{Role: "system", Content: preset.SystemPrompt})
+	}
+
+	// 按模型的上下文窗口截断消息，保留系统提示词和最新的消息
+	strategy := cfg.LLM.Context.Strategy
+	if input.ContextStrategy != "" {
+		if !config.ValidContextStrategy(input.ContextStrategy) {
+			apperr.Respond(c, apperr.ErrInvalidContextStrategy)
+			return nil, false
+		}
+		strategy = input.ContextStrategy
+	}
+	budget := cfg.LLM.PromptBudget(cfg.LLM.ResolveOptions(input.Model, options))
+	messages, report, err := prompt.fit(budget, strategy)
+	if err != nil {
+		apperr.Respond(c, apperr.ErrInvalidContextBudget)
+		return nil, false
+	}
+	report.Summarized = summarized
+
+	return &chatRequest{
+		UserID:   userID,
+		Input:    input,
+		Config:   cfg,
+		Messages: messages,
+		Options:  options,
+		Preset:   preset,
+		Context:  report,
+
+		Citations: citations,
+		Tools:     toolDefinitions,
+		Format:    format,
+
+		Logger:       middleware.Logger(c),
+		TraceContext: context.WithoutCancel(c.Request.Context()),
+	}, true
+}
+
+// StreamChat 处理流式聊天请求
+func StreamChat(c *gin.Context) {
+	started := time.Now()
+	req, ok := bindChatRequest(c)
+	if !ok {
 		return
 	}
+	input := req.Input
 
-	// 打印请求信息
-	fmt.Println("发送流式聊天请求，模型:", input.Model)
-	fmt.Println("消息数量:", len(input.Messages))
-    fmt.Println("历史记录ID:", input.HistoryID)
+	// 记录请求信息
+	req.Logger.Info("发送流式聊天请求", "model", input.Model, "messages", len(input.Messages), "history_id", input.HistoryID)
 
 	// 创建LLM客户端
-	client := config.NewLLMClient()
+	client := config.NewLLMClient(req.Config.LLM)
+	client.Logger = req.Logger
+	client.Context = req.TraceContext
 
 	// 设置响应头，通知前端这是一个流式响应
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	
+
 	// 创建一个响应收集器，用于收集AI的响应内容
-	var aiResponseContent string
-	
-	// 先创建ResponseCollector实例
 	responseCollector := &ResponseCollector{
-		Writer: c.Writer,
-		UserID: userID,
-		ModelName: input.Model,
-		UserMessages: input.Messages,
-		HistoryID: input.HistoryID,
-		ResponseContent: "",
-	}
-	
-	// 然后设置CollectContent函数
+		Writer:  c.Writer,
+		Request: req,
+	}
+
+	// 设置CollectContent函数
 	responseCollector.CollectContent = func(content string) {
-		aiResponseContent += content
 		responseCollector.ResponseContent += content
 	}
 
 	// 发送流式请求到模型并直接将响应流式传输给客户端
-	err := client.StreamChat(responseCollector, input.Messages, input.Options, input.Model)
+	// 模型请求调用工具时执行工具，将结果追加到消息中继续生成
+	err := streamChatLoop(client, responseCollector, req)
+	recordAudit(c, req, started, auditResult{
+		Completion:    responseCollector.ResponseContent,
+		HistoryID:     responseCollector.HistoryID,
+		Usage:         responseCollector.Usage,
+		ModelDuration: responseCollector.ModelDuration,
+		Err:           err,
+	})
 	if err != nil {
-		fmt.Println("流式模型请求失败:", err)
+		req.Logger.Error("流式模型请求失败", "model", input.Model, "error", err)
 		// 注意：此时可能已经发送了部分响应，无法再发送JSON错误响应
-		// 可以考虑发送一个特殊的事件消息表示错误
-		c.Writer.Write([]byte(fmt.Sprintf("event: error\ndata: {\"error\": \"模型请求失败: %v\"}\n\n", err)))
+		// 通过error事件通知客户端，服务关闭时被中断的回复已保存，附带历史记录ID
+		payload := apperr.Body(c, modelError(err))
+		if responseCollector.HistoryID != "" {
+			payload["history_id"] = responseCollector.HistoryID
+		}
+		responseCollector.writeEvent("error", payload)
 		c.Writer.Flush()
 		return
 	}
-	
+
 	// 注意：历史记录的创建已经移到ResponseCollector的Write方法中处理
 	// 这里不再需要单独创建历史记录
 }
 
+// Chat 处理非流式聊天请求，返回完整的AI回复和用量统计
+func Chat(c *gin.Context) {
+	started := time.Now()
+	req, ok := bindChatRequest(c)
+	if !ok {
+		return
+	}
+	input := req.Input
+	if len(req.Tools) > 0 {
+		apperr.Respond(c, apperr.ErrToolsStreamOnly)
+		return
+	}
+
+	// 发送请求到模型，指定了输出格式时校验输出，不符合格式则带上错误重试
+	client := config.NewLLMClient(req.Config.LLM)
+	client.Logger = req.Logger
+	client.Context = req.TraceContext
+	messages := req.Messages
+	var resp *config.ChatResponse
+	var reasoning, answer string
+	var parsed interface{}
+	var validationErrors []string
+	var audit auditResult
+	attempts := 0
+	for {
+		var err error
+		attempts++
+		resp, err = client.Chat(messages, req.Options, input.Model, req.params())
+		if err != nil {
+			audit.Err = err
+			recordAudit(c, req, started, audit)
+			apperr.Respond(c, modelError(err))
+			return
+		}
+		usage := resp.Usage()
+		audit.Usage.PromptTokens += usage.PromptTokens
+		audit.Usage.CompletionTokens += usage.CompletionTokens
+		audit.Usage.TotalTokens = audit.Usage.PromptTokens + audit.Usage.CompletionTokens
+		audit.ModelDuration += resp.TotalDuration
+
+		// 拆分推理内容，与流式接口相同的方式保存聊天历史
+		reasoning, answer = config.SplitReasoning(resp.Message.Content)
+		if req.Format == nil {
+			break
+		}
+		parsed, validationErrors = req.Format.Validate(answer)
+		if len(validationErrors) == 0 || attempts > input.FormatRetries {
+			break
+		}
+		messages = req.Format.RetryMessages(messages, answer, validationErrors)
+	}
+
+	aiMessage := config.Message{
+		Role:      "assistant",
+		Content:   answer,
+		Reasoning: reasoning,
+	}
+	historyID := persistChatHistory(req, aiMessage, "")
+	audit.Completion = answer
+	audit.HistoryID = historyID
+	recordAudit(c, req, started, audit)
+
+	response := gin.H{
+		"history_id":  historyID,
+		"model":       resp.Model,
+		"message":     aiMessage,
+		"done_reason": resp.DoneReason,
+		"usage":       audit.Usage, // 包括输出格式校验失败后重试的用量，与流式接口一致
+		"context":     req.Context,
+		"citations":   req.Citations,
+		"timings": gin.H{
+			"total_duration":       resp.TotalDuration,
+			"load_duration":        resp.LoadDuration,
+			"prompt_eval_duration": resp.PromptEvalDuration,
+			"eval_duration":        resp.EvalDuration,
+		},
+	}
+	if req.Format != nil {
+		response["parsed"] = parsed
+		response["validation_errors"] = validationErrors
+		response["attempts"] = attempts
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// validateChatInput 补全默认模型并检查模型是否允许使用、消息是否超出限制
+func validateChatInput(input *ChatInput, settings config.LLMSettings) error {
+	if input.Model == "" {
+		input.Model = settings.DefaultModel
+	}
+	if input.Model == "" {
+		return apperr.ErrModelRequired
+	}
+	if !settings.ModelAllowed(input.Model) {
+		return apperr.ErrModelNotAllowed.With(input.Model)
+	}
+	if input.FormatRetries < 0 || input.FormatRetries > settings.Limits.MaxFormatRetries {
+		return apperr.ErrFormatRetries.With(settings.Limits.MaxFormatRetries)
+	}
+
+	limits := settings.Limits
+	if limits.MaxMessages > 0 && len(input.Messages) > limits.MaxMessages {
+		return apperr.ErrTooManyMessages.With(limits.MaxMessages)
+	}
+	if limits.MaxMessageLength > 0 {
+		for _, message := range input.Messages {
+			if utf8.RuneCountInString(message.Content) > limits.MaxMessageLength {
+				return apperr.ErrMessageTooLong.With(limits.MaxMessageLength)
+			}
+		}
+	}
+	return nil
+}
+
+// upstreamErrors 模型后端错误分类对应的应用错误
+var upstreamErrors = map[config.UpstreamKind]*apperr.Error{
+	config.UpstreamUnavailable:     apperr.ErrUpstreamDown,
+	config.UpstreamModelNotFound:   apperr.ErrModelNotFound,
+	config.UpstreamOutOfMemory:     apperr.ErrModelOutOfMemory,
+	config.UpstreamTimeout:         apperr.ErrUpstreamTimeout,
+	config.UpstreamContextOverflow: apperr.ErrContextOverflow,
+}
+
+// modelError 将模型请求的错误转换为应用错误，按后端错误的分类返回不同的错误码
+func modelError(err error) error {
+	if errors.Is(err, config.ErrShuttingDown) {
+		return apperr.ErrShuttingDown.Wrap(err)
+	}
+	var upstream *config.UpstreamError
+	if errors.As(err, &upstream) {
+		if appErr, ok := upstreamErrors[upstream.Kind]; ok {
+			return appErr.Wrap(err)
+		}
+	}
+	return apperr.ErrUpstream.Wrap(err)
+}
+
+// userPreferences 获取用户偏好的模型参数，获取失败时返回空参数
+func userPreferences(userID uint) map[string]interface{} {
+	user, err := models.FindUserByID(userID)
+	if err != nil {
+		return nil
+	}
+	options, err := user.GetPreferences()
+	if err != nil {
+		return nil
+	}
+	return options
+}
+
 // ResponseCollector 用于同时收集AI响应内容并转发给客户端
 type ResponseCollector struct {
 	http.ResponseWriter
 	Writer         http.ResponseWriter
 	CollectContent func(string)
 	// 新增字段
-	UserID         uint
-	ModelName      string
-	UserMessages   []config.Message
-	HistoryID      string
-	LastDoneData   []byte // 存储最后一条done=true的数据
-	ResponseContent string // 存储收集到的AI响应内容
+	Request          *chatRequest // 当前聊天请求，用于保存历史记录
+	LastDoneData     []byte       // 存储最后一条done=true的数据
+	ResponseContent  string       // 存储收集到的AI响应内容
+	ReasoningContent string       // 存储收集到的推理内容
+	Splitter         config.ThinkSplitter
+	ToolCalls        []config.ToolCall // 本轮生成中模型请求调用的工具
+	ToolsOffered     bool              // 本轮是否向模型提供了工具，未提供时忽略模型返回的工具调用
+	FormatAttempts   int               // 已完成的结构化输出生成次数
+	FormatErrors     []string          // 本轮输出的格式校验错误，需要重试时不为空
+	HistoryID        string            // 保存的聊天历史ID
+	Usage            config.Usage      // 累计的token用量，包括工具调用和格式重试的各轮生成
+	ModelDuration    int64             // 累计的模型耗时，单位纳秒
+	Tag              gin.H             // 附加到每条数据和事件中的字段，对比模式下用于标记模型
+	ClientGone       bool              // 客户端已断开，之后不再转发数据，但继续收集回复并保存聊天历史
 }
 
-// Write 实现http.ResponseWriter接口
-func (rc *ResponseCollector) Write(data []byte) (int, error) {
-	// 尝试解析事件数据以提取内容
-	dataStr := string(data)
+// reset 清空本轮生成的状态，用于工具调用或格式重试后继续生成
+func (rc *ResponseCollector) reset() {
+	rc.ResponseContent = ""
+	rc.ReasoningContent = ""
+	rc.Splitter = config.ThinkSplitter{}
+	rc.ToolCalls = nil
+	rc.FormatErrors = nil
+}
 
+// Write 实现http.ResponseWriter接口，每次写入Ollama返回的一行JSON
+func (rc *ResponseCollector) Write(data []byte) (int, error) {
 	// 尝试解析JSON内容
 	var jsonData map[string]interface{}
-	err := json.Unmarshal([]byte(dataStr), &jsonData)
-	if err == nil {
-		// 如果包含content字段，则收集内容
-		// 先检查message字段是否存在并且是map类型
-		if message, ok := jsonData["message"].(map[string]interface{}); ok {
-			// 然后从message map中获取content字段
-			if content, ok := message["content"].(string); ok {
-				rc.CollectContent(content)
+	if err := json.Unmarshal(data, &jsonData); err != nil {
+		// 解析失败的情况直接转发数据
+		return rc.forward(data)
+	}
+
+	for key, value := range rc.Tag {
+		jsonData[key] = value
+	}
+
+	// 拆分推理内容和回答内容，推理内容作为单独的reasoning事件发送
+	done, _ := jsonData["done"].(bool)
+	if done {
+		rc.addUsage(jsonData)
+	}
+	if message, ok := jsonData["message"].(map[string]interface{}); ok {
+		// 记录模型请求调用的工具，由streamChatLoop执行
+		// 达到最大轮数后模型仍可能模仿之前的工具消息返回工具调用，此时忽略
+		if calls, ok := message["tool_calls"]; ok && rc.ToolsOffered {
+			if callsJSON, err := json.Marshal(calls); err == nil {
+				var toolCalls []config.ToolCall
+				if json.Unmarshal(callsJSON, &toolCalls) == nil {
+					rc.ToolCalls = append(rc.ToolCalls, toolCalls...)
+				}
 			}
 		}
-		
-		// 检查是否是最后一条消息（done=true）
-		if done, ok := jsonData["done"].(bool); ok && done {
-			// 如果是最后一条消息，暂存数据，不立即发送
-			rc.LastDoneData = make([]byte, len(data))
-			copy(rc.LastDoneData, data)
-			
-			// 如果需要创建或更新历史记录
-			if rc.UserID > 0 && rc.LastDoneData != nil {
-				// 创建AI响应消息
-				aiMessage := config.Message{
-					Role:    "assistant",
-					Content: rc.ResponseContent,
-				}
-				
-				// 创建或更新聊天历史记录
-				var historyID string
-				if rc.HistoryID == "" {
-					// 创建新的聊天历史记录
-					historyID = createChatHistoryFromStream(rc.UserID, rc.ModelName, rc.UserMessages, aiMessage)
-					fmt.Println("新的聊天历史记录已创建，ID:", historyID)
-				} else {
-					// 使用现有的历史记录ID
-					historyID = rc.HistoryID
-					// 更新现有历史记录
-					updateChatHistoryFromStream(rc.HistoryID, rc.UserMessages, aiMessage)
-					fmt.Println("聊天历史记录已更新，ID:", historyID)
-				}
-				
-				// 修改原始JSON数据，添加history_id字段
-				if historyID != "" {
-					jsonData["history_id"] = historyID
-					// 重新序列化JSON
-					newJSONContent, err := json.Marshal(jsonData)
-					if err == nil {
-						// 构造新的SSE消息
-						newData := []byte(string(newJSONContent) + "\n\n")
-						// 发送修改后的数据
-						return rc.Writer.Write(newData)
-					}
+		delete(message, "tool_calls")
+
+		if content, ok := message["content"].(string); ok {
+			reasoning, answer := rc.Splitter.Push(content)
+			if done {
+				restReasoning, restAnswer := rc.Splitter.Flush()
+				reasoning += restReasoning
+				answer += restAnswer
+			}
+
+			if reasoning != "" {
+				rc.ReasoningContent += reasoning
+				if _, err := rc.writeEvent("reasoning", gin.H{"content": reasoning}); err != nil {
+					return 0, err
 				}
 			}
-			
-			// 如果无法处理历史记录，则发送原始数据
-			return rc.Writer.Write(data)
+
+			rc.CollectContent(answer)
+			message["content"] = answer
+
+			// 只包含推理内容的分片不再转发
+			if answer == "" && !done {
+				return len(data), nil
+			}
+		}
+	}
+
+	// 本轮以工具调用结束时还不是最后一条消息，不转发done数据，也不保存历史记录
+	if done && len(rc.ToolCalls) > 0 {
+		return len(data), nil
+	}
+
+	// 校验结构化输出，不符合格式且还可以重试时不转发done数据，由streamChatLoop重试
+	if done && rc.Request != nil && rc.Request.Format != nil {
+		rc.FormatAttempts++
+		parsed, validationErrors := rc.Request.Format.Validate(rc.ResponseContent)
+		if len(validationErrors) > 0 && rc.FormatAttempts <= rc.Request.Input.FormatRetries {
+			rc.FormatErrors = validationErrors
+			return len(data), nil
+		}
+		jsonData["parsed"] = parsed
+		jsonData["validation_errors"] = validationErrors
+		jsonData["attempts"] = rc.FormatAttempts
+	}
+
+	// 检查是否是最后一条消息（done=true）
+	if done {
+		// 附带上下文截断结果和知识库引用
+		if rc.Request != nil {
+			jsonData["context"] = rc.Request.Context
+			if len(rc.Request.Citations) > 0 {
+				jsonData["citations"] = rc.Request.Citations
+			}
+		}
+
+		// 暂存最后一条数据
+		rc.LastDoneData = make([]byte, len(data))
+		copy(rc.LastDoneData, data)
+
+		// 如果需要创建或更新历史记录
+		if rc.Request != nil && rc.Request.UserID > 0 {
+			// 创建或更新聊天历史记录，并在最后一条数据中添加history_id字段
+			if historyID := rc.saveHistory(""); historyID != "" {
+				jsonData["history_id"] = historyID
+			}
+			if rc.Request.CompareGroupID != "" {
+				jsonData["compare_group_id"] = rc.Request.CompareGroupID
+			}
 		}
 	}
-	
-	
-	// 对于非最后一条消息或解析失败的情况，直接转发数据
-	return rc.Writer.Write(data)
+
+	// 重新序列化修改后的数据
+	newJSONContent, err := json.Marshal(jsonData)
+	if err != nil {
+		return rc.forward(data)
+	}
+	if done {
+		return rc.forward(append(newJSONContent, '\n', '\n'))
+	}
+	return rc.forward(append(newJSONContent, '\n'))
+}
+
+// forward 将数据转发给客户端，客户端断开后丢弃数据并返回成功
+// 模型请求不会因客户端断开而取消，继续收集回复，生成结束后照常保存聊天历史
+func (rc *ResponseCollector) forward(data []byte) (int, error) {
+	if rc.ClientGone {
+		return len(data), nil
+	}
+	if _, err := rc.Writer.Write(data); err != nil {
+		rc.ClientGone = true
+		if rc.Request != nil && rc.Request.Logger != nil {
+			rc.Request.Logger.Debug("客户端已断开，继续生成并保存回复", "error", err)
+		}
+	}
+	return len(data), nil
+}
+
+// saveHistory 将本轮生成的回复保存到聊天历史记录，返回历史记录ID，保存失败时返回空字符串
+// errorCode不为空时表示生成过程中出错，历史记录标记为出错状态
+func (rc *ResponseCollector) saveHistory(errorCode apperr.Code) string {
+	aiMessage := config.Message{
+		Role:      "assistant",
+		Content:   rc.ResponseContent,
+		Reasoning: strings.TrimSpace(rc.ReasoningContent),
+	}
+	historyID := persistChatHistory(rc.Request, aiMessage, errorCode)
+	if historyID != "" {
+		rc.HistoryID = historyID
+	}
+	return historyID
+}
+
+// savePartial 生成出错或被中断时保存已生成的部分回复并标记为出错状态，没有生成任何内容时不保存
+func (rc *ResponseCollector) savePartial(err error) {
+	if rc.Request == nil || rc.Request.UserID == 0 {
+		return
+	}
+	reasoning, answer := rc.Splitter.Flush()
+	rc.ReasoningContent += reasoning
+	rc.ResponseContent += answer
+	if rc.ResponseContent == "" && strings.TrimSpace(rc.ReasoningContent) == "" {
+		return
+	}
+	rc.saveHistory(apperr.From(modelError(err)).Code)
+}
+
+// addUsage 累计每轮生成最后一条数据中的token用量和耗时
+func (rc *ResponseCollector) addUsage(jsonData map[string]interface{}) {
+	promptTokens, _ := jsonData["prompt_eval_count"].(float64)
+	completionTokens, _ := jsonData["eval_count"].(float64)
+	duration, _ := jsonData["total_duration"].(float64)
+	rc.Usage.PromptTokens += int(promptTokens)
+	rc.Usage.CompletionTokens += int(completionTokens)
+	rc.Usage.TotalTokens = rc.Usage.PromptTokens + rc.Usage.CompletionTokens
+	rc.ModelDuration += int64(duration)
+}
+
+// writeEvent 向客户端发送一个带事件类型的SSE消息
+func (rc *ResponseCollector) writeEvent(event string, payload gin.H) (int, error) {
+	for key, value := range rc.Tag {
+		payload[key] = value
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	return rc.forward([]byte("event: " + event + "\ndata: " + string(payloadJSON) + "\n\n"))
 }
 
 // Header 实现http.ResponseWriter接口
@@ -184,67 +673,167 @@ func (rc *ResponseCollector) WriteHeader(statusCode int) {
 
 // Flush 实现http.Flusher接口
 func (rc *ResponseCollector) Flush() {
+	if rc.ClientGone {
+		return
+	}
 	if f, ok := rc.Writer.(http.Flusher); ok {
 		f.Flush()
 	}
 }
 
+// persistChatHistory 创建或更新聊天历史记录，返回历史记录ID，保存失败时返回空字符串
+// errorCode不为空时历史记录标记为出错状态，并记录错误码
+func persistChatHistory(req *chatRequest, aiMessage config.Message, errorCode apperr.Code) string {
+	historyID := req.Input.HistoryID
+	if historyID == "" {
+		// 创建新的聊天历史记录
+		historyID = createChatHistoryFromStream(req, aiMessage, errorCode)
+		req.Logger.Info("聊天历史记录已创建", "history_id", historyID)
+		// 对比模式的记录在选出胜者后再生成摘要
+		if req.CompareGroupID == "" {
+			maybeSummarize(req.Config.LLM, historyID)
+		}
+		return historyID
+	}
+
+	// 更新现有历史记录
+	if !updateChatHistoryFromStream(req, aiMessage, errorCode) {
+		return ""
+	}
+	req.Logger.Info("聊天历史记录已更新", "history_id", historyID)
+	maybeSummarize(req.Config.LLM, historyID)
+	return historyID
+}
+
+// historyMessages 构建保存到历史记录的完整消息列表（用户消息、工具调用过程和AI响应）
+func historyMessages(req *chatRequest, aiMessage config.Message) []config.Message {
+	messages := make([]config.Message, 0, len(req.Input.Messages)+len(req.ToolMessages)+1)
+	messages = append(messages, req.Input.Messages...)
+	messages = append(messages, req.ToolMessages...)
+	return append(messages, aiMessage)
+}
+
+// historyStatus 返回错误码对应的历史记录状态
+func historyStatus(errorCode apperr.Code) string {
+	if errorCode != "" {
+		return models.HistoryStatusError
+	}
+	return models.HistoryStatusCompleted
+}
+
 // createChatHistoryFromStream 从流式聊天创建新的聊天历史记录
-func createChatHistoryFromStream(userID uint, modelName string, userMessages []config.Message, aiMessage config.Message) string {
+func createChatHistoryFromStream(req *chatRequest, aiMessage config.Message, errorCode apperr.Code) string {
 	// 创建包含用户消息和AI响应的完整消息列表
-	messages := append(userMessages, aiMessage)
-	
+	messages := historyMessages(req, aiMessage)
+
 	// 创建聊天历史记录
 	history := models.ChatHistory{
 		HistoryID: uuid.New().String(), // 生成唯一的历史记录ID
-		UserID:    userID,
-		ModelName: modelName,
+		UserID:    req.UserID,
+		ModelName: req.Input.Model,
+		PresetID:  req.presetID(),
+
+		CompareGroupID:  req.CompareGroupID,
+		CompareParentID: req.CompareParentID,
+
+		Status:    historyStatus(errorCode),
+		ErrorCode: string(errorCode),
 	}
-	
+
 	// 将消息转换为JSON字符串
 	messagesJSON, err := json.Marshal(messages)
 	if err == nil {
 		history.Messages = string(messagesJSON)
-		
+
 		// 保存到数据库
-		result := models.DB.Create(&history)
+		result := models.DB.WithContext(req.TraceContext).Create(&history)
 		if result.Error == nil {
 			return history.HistoryID
 		}
 	}
-	
+
 	return ""
 }
 
 // updateChatHistoryFromStream 更新现有的聊天历史记录
-func updateChatHistoryFromStream(historyID string, userMessages []config.Message, aiMessage config.Message) bool {
+func updateChatHistoryFromStream(req *chatRequest, aiMessage config.Message, errorCode apperr.Code) bool {
 	// 获取现有的聊天历史记录
-	history, err := models.GetChatHistoryByHistoryID(historyID)
+	history, err := models.GetChatHistoryByHistoryID(req.Input.HistoryID)
 	if err != nil {
-		fmt.Println("获取聊天历史记录失败:", err)
+		req.Logger.Warn("获取聊天历史记录失败", "history_id", req.Input.HistoryID, "error", err)
+		return false
+	}
+
+	// 验证是否属于当前用户
+	if history.UserID != req.UserID {
+		req.Logger.Warn("无权更新该聊天历史记录", "history_id", req.Input.HistoryID)
 		return false
 	}
-	
+
 	// 创建包含用户消息和AI响应的完整消息列表
-	messages := append(userMessages, aiMessage)
-	
+	messages := historyMessages(req, aiMessage)
+
 	// 将消息转换为JSON字符串
 	messagesJSON, err := json.Marshal(messages)
 	if err != nil {
-		fmt.Println("序列化消息失败:", err)
+		req.Logger.Error("序列化消息失败", "history_id", req.Input.HistoryID, "error", err)
 		return false
 	}
-	
-	// 更新消息内容
+
+	// 更新消息内容和状态，记录本次使用的预设
 	history.Messages = string(messagesJSON)
-	
-	// 保存到数据库
-	result := models.DB.Save(history)
+	if presetID := req.presetID(); presetID != nil {
+		history.PresetID = presetID
+	}
+	history.Status = historyStatus(errorCode)
+	history.ErrorCode = string(errorCode)
+
+	// 保存到数据库，只更新消息、预设和状态，摘要由后台任务单独更新
+	result := models.DB.WithContext(req.TraceContext).Model(history).Select("Messages", "PresetID", "Status", "ErrorCode").Updates(history)
 	if result.Error != nil {
-		fmt.Println("更新聊天历史记录失败:", result.Error)
+		req.Logger.Error("更新聊天历史记录失败", "history_id", req.Input.HistoryID, "error", result.Error)
 		return false
 	}
-	
+
 	return true
 }
 
+// streamChatLoop 流式请求模型，直到得到最终回答
+// 模型请求调用工具时执行工具后继续生成，输出不符合指定格式时带上校验错误重新生成
+func streamChatLoop(client *config.LLMClient, rc *ResponseCollector, req *chatRequest) error {
+	messages := req.Messages
+	round := 0
+	for {
+		// 达到最大轮数后不再提供工具，要求模型直接回答
+		params := req.params()
+		if round >= req.Config.LLM.Tools.MaxRounds {
+			params.Tools = nil
+		}
+		rc.ToolsOffered = len(params.Tools) > 0
+
+		if err := client.StreamChat(rc, messages, req.Options, req.Input.Model, params); err != nil {
+			// 模型出错或服务关闭时被中断，保存已生成的部分回复
+			rc.savePartial(err)
+			return err
+		}
+
+		switch {
+		case len(rc.ToolCalls) > 0:
+			round++
+			var err error
+			if messages, err = runToolCalls(rc, req, messages, round); err != nil {
+				return err
+			}
+		case len(rc.FormatErrors) > 0:
+			// 通知客户端丢弃本次输出
+			if _, err := rc.writeEvent("format_retry", gin.H{"attempt": rc.FormatAttempts, "errors": rc.FormatErrors}); err != nil {
+				return err
+			}
+			rc.Flush()
+			messages = req.Format.RetryMessages(messages, rc.ResponseContent, rc.FormatErrors)
+			rc.reset()
+		default:
+			return nil
+		}
+	}
+}
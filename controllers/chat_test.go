@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+)
+
+// closedURL 返回一个已关闭端口的地址，连接时会被拒绝
+func closedURL(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	listener.Close()
+	return url
+}
+
+func TestModelErrorFromUpstream(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc // 为空时后端连接被拒绝
+		code    apperr.Code
+		status  int
+	}{
+		{
+			name: "连接被拒绝",
+			code: apperr.CodeUpstreamDown, status: http.StatusServiceUnavailable,
+		},
+		{
+			name: "模型不存在",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":"model \"llama9\" not found, try pulling it first"}`)
+			},
+			code: apperr.CodeModelNotFound, status: http.StatusNotFound,
+		},
+		{
+			name: "后端返回5xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"error":"llama runner process has terminated"}`)
+			},
+			code: apperr.CodeUpstreamError, status: http.StatusBadGateway,
+		},
+		{
+			name: "加载模型内存不足",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `{"error":"model requires more system memory (12.0 GiB) than is available (8.0 GiB)"}`)
+			},
+			code: apperr.CodeModelOutOfMemory, status: http.StatusServiceUnavailable,
+		},
+		{
+			name: "生成过程中返回错误行",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, `{"message":{"role":"assistant","content":"你好"},"done":false}`)
+				fmt.Fprintln(w, `{"error":"CUDA error: out of memory"}`)
+			},
+			code: apperr.CodeModelOutOfMemory, status: http.StatusServiceUnavailable,
+		},
+		{
+			name: "超过上下文窗口",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"the input length exceeds the context length"}`)
+			},
+			code: apperr.CodeContextOverflow, status: http.StatusBadRequest,
+		},
+		{
+			name: "等待首个token超时",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Millisecond * 500):
+				}
+			},
+			code: apperr.CodeUpstreamTimeout, status: http.StatusGatewayTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := closedURL(t)
+			if tt.handler != nil {
+				server := httptest.NewServer(tt.handler)
+				defer server.Close()
+				url = server.URL
+			}
+
+			settings := config.LLMSettings{
+				Backends: []config.Backend{{Name: "test", URL: url, Provider: config.ProviderOllama}},
+				Timeouts: config.TimeoutSettings{Connect: time.Second, FirstToken: time.Millisecond * 100, Idle: time.Second},
+			}
+			client := config.NewLLMClient(settings)
+			messages := []config.Message{{Role: "user", Content: "你好"}}
+			err := client.StreamChat(httptest.NewRecorder(), messages, nil, "llama9", config.ChatParams{})
+			if err == nil {
+				t.Fatal("StreamChat() 应返回错误")
+			}
+
+			appErr := apperr.From(modelError(err))
+			if appErr.Code != tt.code || appErr.Status != tt.status {
+				t.Errorf("modelError() = %s %d, 期望 %s %d (%v)", appErr.Code, appErr.Status, tt.code, tt.status, err)
+			}
+		})
+	}
+}
+
+func TestModelErrorShuttingDown(t *testing.T) {
+	appErr := apperr.From(modelError(fmt.Errorf("生成中断: %w", config.ErrShuttingDown)))
+	if appErr.Code != apperr.CodeShuttingDown || appErr.Status != http.StatusServiceUnavailable {
+		t.Errorf("modelError() = %s %d", appErr.Code, appErr.Status)
+	}
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// CompareChatInput 多模型对比请求结构，其余字段与聊天请求相同
+type CompareChatInput struct {
+	ChatInput
+	Models []string `json:"models"` // 参与对比的模型
+}
+
+// PickWinnerInput 选择对比胜者的请求结构
+type PickWinnerInput struct {
+	HistoryID string `json:"history_id" binding:"required"` // 胜出的聊天历史ID
+}
+
+// compareWriter 将多个模型的流式响应写入同一个SSE连接，每次写入完整的一条消息
+type compareWriter struct {
+	mu     *sync.Mutex
+	writer gin.ResponseWriter
+	header http.Header // 每个模型单独的响应头，避免并发修改连接的响应头
+}
+
+// Write 实现http.ResponseWriter接口
+func (w *compareWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.writer.Write(data)
+	w.writer.Flush()
+	return n, err
+}
+
+// Header 实现http.ResponseWriter接口
+func (w *compareWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader 实现http.ResponseWriter接口，响应状态由对比接口统一写入
+func (w *compareWriter) WriteHeader(statusCode int) {}
+
+// Flush 实现http.Flusher接口，每次写入后已经刷新
+func (w *compareWriter) Flush() {}
+
+// StreamChatCompare 将同一组消息同时发送给多个模型，并把各模型的流式响应合并到一个SSE连接中
+// 每个模型的回复保存为一条聊天历史记录，同一次对比的记录共享compare_group_id
+func StreamChatCompare(c *gin.Context) {
+	started := time.Now()
+
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input CompareChatInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 去掉重复的模型，并检查模型数量
+	cfg := middleware.GetConfig(c)
+	modelNames := make([]string, 0, len(input.Models))
+	seen := make(map[string]bool, len(input.Models))
+	for _, model := range input.Models {
+		if model == "" || seen[model] {
+			continue
+		}
+		seen[model] = true
+		modelNames = append(modelNames, model)
+	}
+	if len(modelNames) < 2 {
+		apperr.Respond(c, apperr.ErrTooFewCompareModels)
+		return
+	}
+	if limit := cfg.LLM.Limits.MaxCompareModels; limit > 0 && len(modelNames) > limit {
+		apperr.Respond(c, apperr.ErrTooManyCompareModels.With(limit))
+		return
+	}
+
+	// 从已有对话发起对比时，对话必须属于当前用户
+	parentID := input.HistoryID
+	if parentID != "" && ownedHistory(parentID, userID) == nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceChatHistory))
+		return
+	}
+
+	// 为每个模型分别构建请求，提示词按各自的上下文窗口截断
+	groupID := uuid.New().String()
+	requests := make([]*chatRequest, 0, len(modelNames))
+	for _, model := range modelNames {
+		modelInput := input.ChatInput
+		modelInput.Model = model
+		modelInput.Messages = append([]config.Message(nil), input.Messages...)
+		req, ok := buildChatRequest(c, userID, modelInput)
+		if !ok {
+			return
+		}
+
+		// 对比结果总是保存为新的记录，选出胜者后再写回原对话
+		req.Input.HistoryID = ""
+		req.CompareGroupID = groupID
+		req.CompareParentID = parentID
+		requests = append(requests, req)
+	}
+
+	middleware.Logger(c).Info("发送对比聊天请求", "models", modelNames, "compare_group_id", groupID)
+
+	// 设置响应头，通知前端这是一个流式响应
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("Transfer-Encoding", "chunked")
+	c.Writer.WriteHeader(http.StatusOK)
+
+	// 各模型并发生成，每条数据和事件都带上model字段
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]gin.H, len(requests))
+	for i, req := range requests {
+		wg.Add(1)
+		go func(i int, req *chatRequest) {
+			defer wg.Done()
+
+			rc := &ResponseCollector{
+				Writer:  &compareWriter{mu: &mu, writer: c.Writer, header: http.Header{}},
+				Request: req,
+				Tag:     gin.H{"model": req.Input.Model},
+			}
+			rc.CollectContent = func(content string) {
+				rc.ResponseContent += content
+			}
+
+			client := config.NewLLMClient(req.Config.LLM)
+			client.Logger = req.Logger
+			client.Context = req.TraceContext
+			result := gin.H{"model": req.Input.Model}
+			err := streamChatLoop(client, rc, req)
+			recordAudit(c, req, started, auditResult{
+				Completion:    rc.ResponseContent,
+				HistoryID:     rc.HistoryID,
+				Usage:         rc.Usage,
+				ModelDuration: rc.ModelDuration,
+				Err:           err,
+			})
+			if err != nil {
+				req.Logger.Error("对比模型请求失败", "model", req.Input.Model, "error", err)
+				payload := apperr.Body(c, modelError(err))
+				if rc.HistoryID != "" {
+					payload["history_id"] = rc.HistoryID
+				}
+				rc.writeEvent("error", payload)
+				result["error"] = payload["error"]
+				result["code"] = payload["code"]
+			}
+			result["history_id"] = rc.HistoryID
+			results[i] = result
+		}(i, req)
+	}
+	wg.Wait()
+
+	// 所有模型完成后发送汇总事件，客户端据此选择胜者
+	payload, _ := json.Marshal(gin.H{"compare_group_id": groupID, "results": results})
+	c.Writer.Write([]byte("event: compare_done\ndata: " + string(payload) + "\n\n"))
+	c.Writer.Flush()
+}
+
+// GetCompareGroup 获取对比分组中各模型的聊天历史记录
+func GetCompareGroup(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	histories, err := models.GetCompareGroup(c.Param("group_id"), userID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceCompareGroup, err))
+		return
+	}
+	if len(histories) == 0 {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceCompareGroup))
+		return
+	}
+
+	responseHistories := make([]gin.H, 0, len(histories))
+	for _, history := range histories {
+		var messages []config.Message
+		if err := json.Unmarshal([]byte(history.Messages), &messages); err != nil {
+			continue // 跳过无法解析的记录
+		}
+		responseHistories = append(responseHistories, gin.H{
+			"history_id": history.HistoryID,
+			"model":      history.ModelName,
+			"preset_id":  history.PresetID,
+			"messages":   messages,
+			"created_at": history.CreatedAt,
+
+			"compare_rejected": history.CompareRejected,
+			"status":           history.Status,
+			"error_code":       history.ErrorCode,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"compare_group_id":  c.Param("group_id"),
+		"compare_parent_id": histories[0].CompareParentID,
+		"histories":         responseHistories,
+	})
+}
+
+// PickCompareWinner 选出对比的胜者，胜者的回复作为主对话继续，同组其他记录标记为未选中
+func PickCompareWinner(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input PickWinnerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 胜者必须属于当前用户和指定的对比分组，且分组尚未选出胜者
+	winner := ownedHistory(input.HistoryID, userID)
+	if winner == nil || winner.CompareGroupID == "" || winner.CompareGroupID != c.Param("group_id") || winner.CompareRejected {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceCompareGroup))
+		return
+	}
+
+	history, err := models.PickCompareWinner(winner)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceCompareGroup, err))
+		return
+	}
+	maybeSummarize(middleware.GetConfig(c).LLM, history.HistoryID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "已选择对比胜者",
+		"history_id": history.HistoryID,
+		"model":      history.ModelName,
+	})
+}
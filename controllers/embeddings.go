@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
+)
+
+// embedBatchSize 每次请求向量模型的文本数
+const embedBatchSize = 32
+
+// EmbeddingsInput 向量嵌入请求结构，兼容OpenAI的/v1/embeddings
+type EmbeddingsInput struct {
+	Model          string          `json:"model"`           // 向量模型，为空时使用rag.embedding_model
+	Input          json.RawMessage `json:"input"`           // 单个字符串或字符串数组
+	EncodingFormat string          `json:"encoding_format"` // 只支持float
+}
+
+// embeddingsResult 向量嵌入结果
+type embeddingsResult struct {
+	Model        string
+	Embeddings   [][]float32
+	PromptTokens int // 实际发送给模型的文本消耗的token数，命中缓存的文本不计入
+	Cached       int // 命中缓存的文本数
+}
+
+// Embeddings 计算文本向量
+func Embeddings(c *gin.Context) {
+	result, err := handleEmbeddings(c)
+	if err != nil {
+		apperr.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"model":      result.Model,
+		"embeddings": result.Embeddings,
+		"cached":     result.Cached,
+		"usage": gin.H{
+			"prompt_tokens": result.PromptTokens,
+			"total_tokens":  result.PromptTokens,
+		},
+	})
+}
+
+// OpenAIEmbeddings 以OpenAI兼容的格式计算文本向量
+func OpenAIEmbeddings(c *gin.Context) {
+	result, err := handleEmbeddings(c)
+	if err != nil {
+		respondOpenAIError(c, err)
+		return
+	}
+
+	data := make([]gin.H, 0, len(result.Embeddings))
+	for i, embedding := range result.Embeddings {
+		data = append(data, gin.H{"object": "embedding", "index": i, "embedding": embedding})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+		"model":  result.Model,
+		"usage": gin.H{
+			"prompt_tokens": result.PromptTokens,
+			"total_tokens":  result.PromptTokens,
+		},
+	})
+}
+
+// respondOpenAIError 以OpenAI兼容的格式写入错误响应，message按Accept-Language选择语言
+func respondOpenAIError(c *gin.Context, err error) {
+	e := apperr.From(err)
+	apperr.Log(c, e)
+	errorType := "invalid_request_error"
+	if e.Status >= http.StatusInternalServerError {
+		errorType = "api_error"
+	}
+	body := apperr.Body(c, e)
+	c.JSON(e.Status, gin.H{"error": gin.H{
+		"message":    body["error"],
+		"type":       errorType,
+		"code":       e.Code,
+		"request_id": body["request_id"],
+	}})
+}
+
+// handleEmbeddings 校验向量嵌入请求并计算向量
+func handleEmbeddings(c *gin.Context) (*embeddingsResult, error) {
+	// 获取用户ID
+	if _, exists := c.Get("user_id"); !exists {
+		return nil, apperr.ErrUnauthorized
+	}
+
+	// 绑定请求数据
+	var input EmbeddingsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		return nil, apperr.ErrInvalidRequest
+	}
+	if input.EncodingFormat != "" && input.EncodingFormat != "float" {
+		return nil, apperr.ErrEncodingFormat
+	}
+	texts, err := parseEmbeddingsInput(input.Input)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验模型和请求限制，与聊天请求使用相同的限制
+	settings := middleware.GetConfig(c).LLM
+	if input.Model == "" {
+		input.Model = settings.RAG.EmbeddingModel
+	}
+	if input.Model == "" {
+		return nil, apperr.ErrModelRequired
+	}
+	if !settings.Embeddings.ModelAllowed(input.Model) {
+		return nil, apperr.ErrModelNotAllowed.With(input.Model)
+	}
+	limits := settings.Limits
+	if limits.MaxMessages > 0 && len(texts) > limits.MaxMessages {
+		return nil, apperr.ErrTooManyInputs.With(limits.MaxMessages)
+	}
+	if limits.MaxMessageLength > 0 {
+		for _, text := range texts {
+			if utf8.RuneCountInString(text) > limits.MaxMessageLength {
+				return nil, apperr.ErrInputTooLong.With(limits.MaxMessageLength)
+			}
+		}
+	}
+
+	result, err := embedTexts(c.Request.Context(), settings, input.Model, texts)
+	if err != nil {
+		return nil, modelError(err)
+	}
+	return result, nil
+}
+
+// parseEmbeddingsInput 解析单个字符串或字符串数组形式的输入
+func parseEmbeddingsInput(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		if single == "" {
+			return nil, apperr.ErrEmptyInput
+		}
+		return []string{single}, nil
+	}
+
+	var batch []string
+	if err := json.Unmarshal(raw, &batch); err != nil {
+		return nil, apperr.ErrInputType
+	}
+	if len(batch) == 0 {
+		return nil, apperr.ErrEmptyInput
+	}
+	for _, text := range batch {
+		if text == "" {
+			return nil, apperr.ErrEmptyInputItem
+		}
+	}
+	return batch, nil
+}
+
+// embedTexts 计算一组文本的向量，优先读取磁盘缓存，只将未命中的文本分批发送给模型
+func embedTexts(ctx context.Context, settings config.LLMSettings, model string, texts []string) (*embeddingsResult, error) {
+	cache := config.NewEmbeddingCache(settings.Embeddings.CacheDir)
+	result := &embeddingsResult{Model: model, Embeddings: make([][]float32, len(texts))}
+
+	var missing []int
+	for i, text := range texts {
+		if vector, ok := cache.Get(model, text); ok {
+			result.Embeddings[i] = vector
+			result.Cached++
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	client := config.NewLLMClient(settings)
+	client.Context = ctx
+	for start := 0; start < len(missing); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := make([]string, 0, end-start)
+		for _, i := range missing[start:end] {
+			batch = append(batch, texts[i])
+		}
+
+		resp, err := client.Embed(model, batch)
+		if err != nil {
+			return nil, err
+		}
+		result.PromptTokens += resp.PromptEvalCount
+		for j, i := range missing[start:end] {
+			result.Embeddings[i] = resp.Embeddings[j]
+			if err := cache.Put(model, texts[i], resp.Embeddings[j]); err != nil {
+				slog.Warn("写入向量缓存失败", "model", model, "error", err)
+			}
+		}
+	}
+	return result, nil
+}
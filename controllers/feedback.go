@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// maxFeedbackCommentLength 评价说明的最大字符数
+const maxFeedbackCommentLength = 2000
+
+// FeedbackInput 创建评价的请求结构
+type FeedbackInput struct {
+	HistoryID    string `json:"history_id" binding:"required"`
+	MessageIndex int    `json:"message_index"` // 被评价的消息下标，必须是AI回复
+	Rating       string `json:"rating" binding:"required"`
+	Comment      string `json:"comment"`
+}
+
+// UpdateFeedbackInput 更新评价的请求结构，未提供的字段保持不变
+type UpdateFeedbackInput struct {
+	Rating  string  `json:"rating"`
+	Comment *string `json:"comment"`
+}
+
+// PreferencePair 偏好数据集中的一条数据，chosen和rejected是同一条回复重新生成前后被赞和被踩的版本
+type PreferencePair struct {
+	Prompt        []config.Message `json:"prompt"`
+	Chosen        string           `json:"chosen"`
+	Rejected      string           `json:"rejected"`
+	ChosenModel   string           `json:"chosen_model"`
+	RejectedModel string           `json:"rejected_model"`
+}
+
+// feedbackResponse 构建评价的响应数据
+func feedbackResponse(feedback *models.Feedback) gin.H {
+	return gin.H{
+		"id":            feedback.ID,
+		"history_id":    feedback.HistoryID,
+		"message_index": feedback.MessageIndex,
+		"rating":        feedback.Rating,
+		"comment":       feedback.Comment,
+		"model":         feedback.ModelName,
+		"preset_id":     feedback.PresetID,
+		"response":      feedback.Response,
+		"created_at":    feedback.CreatedAt,
+		"updated_at":    feedback.UpdatedAt,
+	}
+}
+
+// validateFeedback 校验评价和评价说明
+func validateFeedback(rating, comment string) error {
+	if !models.ValidRating(rating) {
+		return apperr.ErrInvalidRating.With(rating)
+	}
+	if utf8.RuneCountInString(comment) > maxFeedbackCommentLength {
+		return apperr.ErrCommentTooLong.With(maxFeedbackCommentLength)
+	}
+	return nil
+}
+
+// CreateFeedback 评价聊天历史中的一条AI回复，对同一条回复重复评价时更新已有评价
+func CreateFeedback(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input FeedbackInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+	if err := validateFeedback(input.Rating, input.Comment); err != nil {
+		apperr.Respond(c, err)
+		return
+	}
+
+	// 被评价的消息必须是用户自己的聊天历史中的AI回复
+	history := ownedHistory(input.HistoryID, userID)
+	if history == nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceChatHistory))
+		return
+	}
+	var messages []config.Message
+	if err := json.Unmarshal([]byte(history.Messages), &messages); err != nil {
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+	if input.MessageIndex < 0 || input.MessageIndex >= len(messages) || messages[input.MessageIndex].Role != "assistant" {
+		apperr.Respond(c, apperr.ErrFeedbackTarget)
+		return
+	}
+	response := messages[input.MessageIndex].Content
+
+	// 同一条回复内容只保留一个评价，重新生成的回复内容不同，会作为新的评价保存
+	feedback, err := models.FindFeedback(userID, history.HistoryID, input.MessageIndex, response)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceFeedback, err))
+		return
+	}
+	if feedback == nil {
+		// 保存回复之前的消息作为提示词，用于导出偏好数据
+		prompt := config.StripReasoning(messages[:input.MessageIndex], false)
+		promptJSON, err := json.Marshal(prompt)
+		if err != nil {
+			apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+			return
+		}
+		feedback = &models.Feedback{
+			UserID:       userID,
+			HistoryID:    history.HistoryID,
+			MessageIndex: input.MessageIndex,
+			ModelName:    history.ModelName,
+			PresetID:     history.PresetID,
+			Prompt:       string(promptJSON),
+			PromptDigest: config.MessagesDigest(prompt),
+			Response:     response,
+		}
+	}
+	feedback.Rating = input.Rating
+	feedback.Comment = input.Comment
+
+	// 保存到数据库
+	if err := models.DB.Save(feedback).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceFeedback, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "评价保存成功", "feedback": feedbackResponse(feedback)})
+}
+
+// ListFeedback 获取当前用户的评价，可以通过history_id参数筛选
+func ListFeedback(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	feedbacks, err := models.GetFeedbacksByUserID(userID, c.Query("history_id"))
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceFeedback, err))
+		return
+	}
+
+	responseFeedbacks := make([]gin.H, 0, len(feedbacks))
+	for i := range feedbacks {
+		responseFeedbacks = append(responseFeedbacks, feedbackResponse(&feedbacks[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"feedback": responseFeedbacks})
+}
+
+// GetFeedback 获取评价详情
+func GetFeedback(c *gin.Context) {
+	feedback, ok := loadFeedback(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feedback": feedbackResponse(feedback)})
+}
+
+// UpdateFeedback 更新评价和评价说明
+func UpdateFeedback(c *gin.Context) {
+	feedback, ok := loadFeedback(c)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input UpdateFeedbackInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+	if input.Rating != "" {
+		feedback.Rating = input.Rating
+	}
+	if input.Comment != nil {
+		feedback.Comment = *input.Comment
+	}
+	if err := validateFeedback(feedback.Rating, feedback.Comment); err != nil {
+		apperr.Respond(c, err)
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Save(feedback).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpUpdate, apperr.ResourceFeedback, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "评价更新成功", "feedback": feedbackResponse(feedback)})
+}
+
+// DeleteFeedback 删除评价
+func DeleteFeedback(c *gin.Context) {
+	feedback, ok := loadFeedback(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteFeedback(feedback.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceFeedback, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "评价删除成功"})
+}
+
+// FeedbackReport 按模型和预设汇总所有用户的评价，仅管理员可用
+func FeedbackReport(c *gin.Context) {
+	stats, err := models.GetFeedbackReport()
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceFeedback, err))
+		return
+	}
+
+	report := make([]gin.H, 0, len(stats))
+	for _, stat := range stats {
+		upRate := 0.0
+		if stat.Total > 0 {
+			upRate = float64(stat.Up) / float64(stat.Total)
+		}
+		report = append(report, gin.H{
+			"model":     stat.ModelName,
+			"preset_id": stat.PresetID,
+			"total":     stat.Total,
+			"up":        stat.Up,
+			"down":      stat.Down,
+			"comments":  stat.Comments,
+			"up_rate":   upRate,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// ExportPreferences 以JSON Lines格式导出偏好数据集，仅管理员可用
+// 同一聊天历史中同一条回复重新生成前后被赞和被踩的版本两两组成一条数据
+func ExportPreferences(c *gin.Context) {
+	feedbacks, err := models.GetPreferenceFeedbacks()
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceFeedback, err))
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="preferences.jsonl"`)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	for start := 0; start < len(feedbacks); {
+		// 查询结果按聊天历史、消息下标和提示词哈希排序，逐组处理
+		end := start
+		for end < len(feedbacks) && sameRegeneration(feedbacks[end], feedbacks[start]) {
+			end++
+		}
+		for _, pair := range preferencePairs(feedbacks[start:end]) {
+			if err := encoder.Encode(pair); err != nil {
+				return
+			}
+		}
+		start = end
+	}
+}
+
+// sameRegeneration 判断两条评价是否针对同一条回复的不同生成版本
+func sameRegeneration(a, b models.Feedback) bool {
+	return a.HistoryID == b.HistoryID && a.MessageIndex == b.MessageIndex && a.PromptDigest == b.PromptDigest
+}
+
+// preferencePairs 将同一条回复的评价组成偏好数据，回复内容相同的不组成数据
+func preferencePairs(group []models.Feedback) []PreferencePair {
+	var prompt []config.Message
+	if err := json.Unmarshal([]byte(group[0].Prompt), &prompt); err != nil {
+		return nil
+	}
+
+	var pairs []PreferencePair
+	for _, chosen := range group {
+		if chosen.Rating != models.RatingUp {
+			continue
+		}
+		for _, rejected := range group {
+			if rejected.Rating != models.RatingDown || rejected.Response == chosen.Response {
+				continue
+			}
+			pairs = append(pairs, PreferencePair{
+				Prompt:        prompt,
+				Chosen:        chosen.Response,
+				Rejected:      rejected.Response,
+				ChosenModel:   chosen.ModelName,
+				RejectedModel: rejected.ModelName,
+			})
+		}
+	}
+	return pairs
+}
+
+// loadFeedback 根据路径参数加载评价并校验只有评价者可以操作
+func loadFeedback(c *gin.Context) (*models.Feedback, bool) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
+	}
+
+	// 获取评价ID
+	feedbackID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceFeedback))
+		return nil, false
+	}
+
+	// 查询评价
+	feedback, err := models.GetFeedbackByID(uint(feedbackID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceFeedback))
+		return nil, false
+	}
+
+	// 验证权限
+	if feedback.UserID != userID {
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceFeedback))
+		return nil, false
+	}
+
+	return feedback, true
+}
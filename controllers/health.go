@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// readyTimeout 就绪检查中每项依赖的超时时间
+const readyTimeout = time.Second * 2
+
+// startedAt 服务启动时间
+var startedAt = time.Now()
+
+// Healthz 存活检查，进程能处理请求即返回成功，不检查外部依赖
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz 就绪检查，数据库可用且至少有一个LLM后端可用时返回成功，否则返回503
+// 后端状态使用定期健康检查的结果，不在未认证的请求中访问后端，也不返回后端地址和错误信息
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	databaseHealthy := models.Ping(ctx) == nil
+
+	backends := backendPoolStatus(c)
+	healthyBackends := 0
+	for _, backend := range backends {
+		if backend.Healthy {
+			healthyBackends++
+		}
+	}
+	ready := databaseHealthy && healthyBackends > 0
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"ready":    ready,
+		"database": databaseHealthy,
+		"backends": gin.H{"healthy": healthyBackends, "total": len(backends)},
+	})
+}
+
+// GetStatus 返回服务版本、运行时长、数据库大小、进行中的流式请求数和各后端状态，仅管理员可用
+func GetStatus(c *gin.Context) {
+	database := gin.H{"path": middleware.GetConfig(c).Database.Path}
+	if size, err := models.DatabaseSize(); err != nil {
+		database["error"] = err.Error()
+	} else {
+		database["size_bytes"] = size
+	}
+
+	uptime := time.Since(startedAt)
+	c.JSON(http.StatusOK, gin.H{
+		"version":        config.Version,
+		"go_version":     runtime.Version(),
+		"started_at":     startedAt,
+		"uptime":         uptime.Round(time.Second).String(),
+		"uptime_seconds": int64(uptime.Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"database":       database,
+		"active_streams": config.ActiveStreams(),
+		"backends":       backendStatuses(backendPoolStatus(c)),
+	})
+}
+
+// backendPoolStatus 返回后端池中各后端最近一次健康检查的状态，后端池不可用时返回空列表
+func backendPoolStatus(c *gin.Context) []config.BackendStatus {
+	pool := config.NewLLMClient(middleware.GetConfig(c).LLM).Pool
+	if pool == nil {
+		return nil
+	}
+	return pool.Status()
+}
+
+// backendStatuses 转换后端状态，延迟以毫秒返回
+func backendStatuses(statuses []config.BackendStatus) []gin.H {
+	result := make([]gin.H, 0, len(statuses))
+	for _, s := range statuses {
+		item := gin.H{
+			"name":       s.Name,
+			"url":        s.URL,
+			"healthy":    s.Healthy,
+			"latency_ms": float64(s.Latency.Microseconds()) / 1000,
+			"last_check": s.LastCheck,
+		}
+		if s.LastError != "" {
+			item["error"] = s.LastError
+		}
+		result = append(result, item)
+	}
+	return result
+}
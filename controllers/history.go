@@ -2,12 +2,12 @@ package controllers
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/trae-ds-go-backend/apperr"
 	"github.com/trae-ds-go-backend/config"
 	"github.com/trae-ds-go-backend/models"
 )
@@ -23,19 +23,19 @@ func SaveChatHistory(c *gin.Context) {
 	// 获取用户ID
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		apperr.Respond(c, apperr.ErrUnauthorized)
 		return
 	}
 	userID, ok := userIDInterface.(uint)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户ID类型错误"})
+		apperr.Respond(c, apperr.ErrInternal)
 		return
 	}
 
 	// 绑定请求数据
 	var input SaveChatHistoryInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		apperr.Respond(c, apperr.ErrInvalidRequest)
 		return
 	}
 
@@ -49,7 +49,7 @@ func SaveChatHistory(c *gin.Context) {
 	// 将消息转换为JSON字符串
 	messagesJSON, err := json.Marshal(input.Messages)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "消息序列化失败"})
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 	history.Messages = string(messagesJSON)
@@ -57,13 +57,13 @@ func SaveChatHistory(c *gin.Context) {
 	// 保存到数据库
 	result := models.DB.Create(&history)
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存聊天历史失败"})
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceChatHistory, result.Error))
 		return
 	}
 
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
-		"message": "聊天历史保存成功",
+		"message":    "聊天历史保存成功",
 		"history_id": history.HistoryID,
 	})
 }
@@ -73,19 +73,19 @@ func GetUserChatHistories(c *gin.Context) {
 	// 获取用户ID
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		apperr.Respond(c, apperr.ErrUnauthorized)
 		return
 	}
 	userID, ok := userIDInterface.(uint)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户ID类型错误"})
+		apperr.Respond(c, apperr.ErrInternal)
 		return
 	}
 
 	// 获取历史记录
 	histories, err := models.GetChatHistoriesByUserID(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取聊天历史失败: %v", err)})
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceChatHistory, err))
 		return
 	}
 
@@ -115,9 +115,14 @@ func GetUserChatHistories(c *gin.Context) {
 			"id":         history.ID,
 			"history_id": history.HistoryID,
 			"model":      history.ModelName,
+			"preset_id":  history.PresetID,
 			"title":      title,
 			"created_at": history.CreatedAt,
 			"updated_at": history.UpdatedAt,
+
+			"compare_group_id": history.CompareGroupID,
+			"status":           history.Status,
+			"error_code":       history.ErrorCode,
 		})
 	}
 
@@ -129,32 +134,32 @@ func GetChatHistoryDetail(c *gin.Context) {
 	// 获取用户ID
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		apperr.Respond(c, apperr.ErrUnauthorized)
 		return
 	}
 	userID, ok := userIDInterface.(uint)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户ID类型错误"})
+		apperr.Respond(c, apperr.ErrInternal)
 		return
 	}
 
 	// 获取历史记录ID
 	historyID := c.Param("history_id")
 	if historyID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "历史记录ID不能为空"})
+		apperr.Respond(c, apperr.ErrHistoryIDMissing)
 		return
 	}
 
 	// 查询历史记录
 	history, err := models.GetChatHistoryByHistoryID(historyID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "聊天历史记录不存在"})
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceChatHistory))
 		return
 	}
 
 	// 验证是否属于当前用户
 	if history.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该聊天历史"})
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceChatHistory))
 		return
 	}
 
@@ -162,17 +167,23 @@ func GetChatHistoryDetail(c *gin.Context) {
 	var messages []config.Message
 	err = json.Unmarshal([]byte(history.Messages), &messages)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析聊天消息失败"})
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
 		return
 	}
 
 	// 返回历史记录详情
 	c.JSON(http.StatusOK, gin.H{
-		"history_id": history.HistoryID,
-		"model":      history.ModelName,
-		"messages":   messages,
-		"created_at": history.CreatedAt,
-		"updated_at": history.UpdatedAt,
+		"history_id":       history.HistoryID,
+		"model":            history.ModelName,
+		"preset_id":        history.PresetID,
+		"messages":         messages,
+		"summary":          history.Summary,
+		"summarized_count": history.SummarizedCount,
+		"compare_group_id": history.CompareGroupID,
+		"status":           history.Status,
+		"error_code":       history.ErrorCode,
+		"created_at":       history.CreatedAt,
+		"updated_at":       history.UpdatedAt,
 	})
 }
 
@@ -181,12 +192,12 @@ func DeleteChatHistory(c *gin.Context) {
 	// 获取用户ID
 	userIDInterface, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		apperr.Respond(c, apperr.ErrUnauthorized)
 		return
 	}
 	userID, ok := userIDInterface.(uint)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "用户ID类型错误"})
+		apperr.Respond(c, apperr.ErrInternal)
 		return
 	}
 
@@ -194,29 +205,29 @@ func DeleteChatHistory(c *gin.Context) {
 	historyIDStr := c.Param("id")
 	historyID, err := strconv.ParseUint(historyIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的历史记录ID"})
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceChatHistory))
 		return
 	}
 
 	// 查询历史记录
 	history, err := models.GetChatHistoryByID(uint(historyID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "聊天历史记录不存在"})
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceChatHistory))
 		return
 	}
 
 	// 验证是否属于当前用户
 	if history.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权删除该聊天历史"})
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceChatHistory))
 		return
 	}
 
 	// 删除历史记录
 	err = models.DeleteChatHistory(uint(historyID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除聊天历史失败"})
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceChatHistory, err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "聊天历史删除成功"})
-}
\ No newline at end of file
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ledongthuc/pdf"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// KnowledgeBaseInput 创建或更新知识库的请求结构
+type KnowledgeBaseInput struct {
+	Name           string `json:"name" binding:"required"`
+	Description    string `json:"description"`
+	EmbeddingModel string `json:"embedding_model"` // 为空时使用配置的默认向量模型，创建后不可修改
+	Shared         bool   `json:"shared"`          // 是否共享给所有用户
+}
+
+// SearchKnowledgeInput 检索知识库的请求结构
+type SearchKnowledgeInput struct {
+	Query string `json:"query" binding:"required"`
+	TopK  int    `json:"top_k"` // 为空时使用配置的默认值，不能超过rag.max_top_k
+}
+
+// knowledgeBaseResponse 构建知识库的响应数据
+func knowledgeBaseResponse(kb *models.KnowledgeBase) gin.H {
+	return gin.H{
+		"id":              kb.ID,
+		"name":            kb.Name,
+		"description":     kb.Description,
+		"embedding_model": kb.EmbeddingModel,
+		"user_id":         kb.UserID,
+		"shared":          kb.Shared,
+		"created_at":      kb.CreatedAt,
+		"updated_at":      kb.UpdatedAt,
+	}
+}
+
+// documentResponse 构建文档的响应数据
+func documentResponse(document *models.Document) gin.H {
+	return gin.H{
+		"id":                document.ID,
+		"knowledge_base_id": document.KnowledgeBaseID,
+		"filename":          document.Filename,
+		"size":              document.Size,
+		"chunk_count":       document.ChunkCount,
+		"user_id":           document.UserID,
+		"created_at":        document.CreatedAt,
+	}
+}
+
+// ListKnowledgeBases 获取当前用户可用的知识库（自己的和共享的）
+func ListKnowledgeBases(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 查询知识库
+	kbs, err := models.GetAccessibleKnowledgeBases(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceKnowledgeBase, err))
+		return
+	}
+
+	responseKBs := make([]gin.H, 0, len(kbs))
+	for i := range kbs {
+		responseKBs = append(responseKBs, knowledgeBaseResponse(&kbs[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_bases": responseKBs})
+}
+
+// CreateKnowledgeBase 创建知识库
+func CreateKnowledgeBase(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input KnowledgeBaseInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	kb := models.KnowledgeBase{
+		Name:           input.Name,
+		Description:    input.Description,
+		EmbeddingModel: input.EmbeddingModel,
+		UserID:         userID,
+		Shared:         input.Shared,
+	}
+	settings := middleware.GetConfig(c).LLM
+	if kb.EmbeddingModel == "" {
+		kb.EmbeddingModel = settings.RAG.EmbeddingModel
+	}
+	if kb.EmbeddingModel == "" {
+		apperr.Respond(c, apperr.ErrEmbeddingModel)
+		return
+	}
+	// 向量模型创建后不可修改，创建时必须在允许列表中
+	if !settings.Embeddings.ModelAllowed(kb.EmbeddingModel) {
+		apperr.Respond(c, apperr.ErrModelNotAllowed.With(kb.EmbeddingModel))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Create(&kb).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceKnowledgeBase, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "知识库创建成功", "knowledge_base": knowledgeBaseResponse(&kb)})
+}
+
+// GetKnowledgeBase 获取知识库详情及其文档列表
+func GetKnowledgeBase(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, false)
+	if !ok {
+		return
+	}
+
+	documents, err := models.GetDocumentsByKnowledgeBaseID(kb.ID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceDocument, err))
+		return
+	}
+	responseDocuments := make([]gin.H, 0, len(documents))
+	for i := range documents {
+		responseDocuments = append(responseDocuments, documentResponse(&documents[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"knowledge_base": knowledgeBaseResponse(kb), "documents": responseDocuments})
+}
+
+// UpdateKnowledgeBase 更新知识库，只有创建者可以修改
+func UpdateKnowledgeBase(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, true)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input KnowledgeBaseInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 已有分块的向量依赖原模型，不允许修改
+	if input.EmbeddingModel != "" && input.EmbeddingModel != kb.EmbeddingModel {
+		apperr.Respond(c, apperr.ErrEmbeddingLocked)
+		return
+	}
+
+	kb.Name = input.Name
+	kb.Description = input.Description
+	kb.Shared = input.Shared
+
+	// 保存到数据库
+	if err := models.DB.Save(kb).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpUpdate, apperr.ResourceKnowledgeBase, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "知识库更新成功", "knowledge_base": knowledgeBaseResponse(kb)})
+}
+
+// DeleteKnowledgeBase 删除知识库及其文档，只有创建者可以删除
+func DeleteKnowledgeBase(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteKnowledgeBase(kb.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceKnowledgeBase, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "知识库删除成功"})
+}
+
+// UploadDocument 上传文档到知识库，提取文本、分块并计算向量，只有创建者可以上传
+func UploadDocument(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, true)
+	if !ok {
+		return
+	}
+	settings := middleware.GetConfig(c).LLM
+
+	// 读取上传的文件
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		apperr.Respond(c, apperr.ErrFileRequired)
+		return
+	}
+	if fileHeader.Size > settings.RAG.MaxUploadSize {
+		apperr.Respond(c, apperr.ErrFileTooLarge.With(settings.RAG.MaxUploadSize))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		apperr.Respond(c, apperr.ErrReadFile.Wrap(err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, settings.RAG.MaxUploadSize+1))
+	if err != nil || int64(len(data)) > settings.RAG.MaxUploadSize {
+		apperr.Respond(c, apperr.ErrReadFile.Wrap(err))
+		return
+	}
+
+	// 提取文本并分块
+	text, err := documentText(fileHeader.Filename, data)
+	if err != nil {
+		apperr.Respond(c, err)
+		return
+	}
+	texts := config.ChunkText(text, settings.RAG.ChunkSize, settings.RAG.ChunkOverlap)
+	if len(texts) == 0 {
+		apperr.Respond(c, apperr.ErrEmptyDocument)
+		return
+	}
+
+	// 计算向量
+	result, err := embedTexts(c.Request.Context(), settings, kb.EmbeddingModel, texts)
+	if err != nil {
+		apperr.Respond(c, apperr.ErrEmbedding.Wrap(err))
+		return
+	}
+	chunks := make([]models.DocumentChunk, 0, len(texts))
+	for i, embedding := range result.Embeddings {
+		chunks = append(chunks, models.DocumentChunk{
+			ChunkIndex: i,
+			Content:    texts[i],
+			Embedding:  models.EncodeVector(embedding),
+		})
+	}
+
+	// 保存文档和分块
+	document := models.Document{
+		KnowledgeBaseID: kb.ID,
+		Filename:        filepath.Base(fileHeader.Filename),
+		Size:            int64(len(data)),
+		ChunkCount:      len(chunks),
+		UserID:          kb.UserID,
+	}
+	if err := models.CreateDocumentWithChunks(&document, chunks); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceDocument, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "文档上传成功", "document": documentResponse(&document)})
+}
+
+// DeleteDocument 从知识库中删除文档，只有创建者可以删除
+func DeleteDocument(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, true)
+	if !ok {
+		return
+	}
+
+	// 获取文档ID
+	documentID, err := strconv.ParseUint(c.Param("document_id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceDocument))
+		return
+	}
+	document, err := models.GetDocumentByID(uint(documentID))
+	if err != nil || document.KnowledgeBaseID != kb.ID {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceDocument))
+		return
+	}
+
+	if err := models.DeleteDocument(document.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceDocument, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "文档删除成功"})
+}
+
+// SearchKnowledgeBase 检索知识库，返回最相似的分块，便于调试检索效果
+func SearchKnowledgeBase(c *gin.Context) {
+	kb, ok := loadKnowledgeBase(c, false)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input SearchKnowledgeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	settings := middleware.GetConfig(c).LLM
+	if input.TopK < 0 || input.TopK > settings.RAG.MaxTopK {
+		apperr.Respond(c, apperr.ErrInvalidTopK.With(settings.RAG.MaxTopK))
+		return
+	}
+	if input.TopK > 0 {
+		settings.RAG.TopK = input.TopK
+	}
+	citations, err := retrieveCitations(c.Request.Context(), settings, []*models.KnowledgeBase{kb}, input.Query)
+	if err != nil {
+		apperr.Respond(c, apperr.ErrKnowledgeSearch.Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": citations})
+}
+
+// loadKnowledgeBase 根据路径参数加载知识库并检查权限，owner为true时要求当前用户是创建者
+func loadKnowledgeBase(c *gin.Context, owner bool) (*models.KnowledgeBase, bool) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
+	}
+
+	// 获取知识库ID
+	kbID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceKnowledgeBase))
+		return nil, false
+	}
+
+	// 查询知识库
+	kb, err := models.GetKnowledgeBaseByID(uint(kbID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceKnowledgeBase))
+		return nil, false
+	}
+
+	// 验证权限
+	if (owner && kb.UserID != userID) || !kb.CanAccess(userID) {
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceKnowledgeBase))
+		return nil, false
+	}
+
+	return kb, true
+}
+
+// extractDocumentText 按扩展名提取文档文本，支持txt、md和pdf
+func extractDocumentText(filename string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt", ".md", ".markdown":
+		if !utf8.Valid(data) {
+			return "", errors.New("文本文件必须使用UTF-8编码")
+		}
+		return string(data), nil
+	case ".pdf":
+		reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", errors.New("无法解析PDF文件")
+		}
+		plain, err := reader.GetPlainText()
+		if err != nil {
+			return "", errors.New("无法提取PDF中的文本")
+		}
+		text, err := io.ReadAll(plain)
+		if err != nil {
+			return "", errors.New("无法提取PDF中的文本")
+		}
+		return string(text), nil
+	}
+	return "", errors.New("不支持的文件类型，仅支持txt、md和pdf")
+}
+
+// documentText 提取文档文本，解析失败时返回无效文档错误
+func documentText(filename string, data []byte) (string, error) {
+	text, err := extractDocumentText(filename, data)
+	if err != nil {
+		return "", apperr.ErrInvalidDocument.WithDetail(err.Error())
+	}
+	return text, nil
+}
+
+// loadChatKnowledgeBases 加载聊天请求指定的知识库并检查权限
+func loadChatKnowledgeBases(userID uint, ids []uint) ([]*models.KnowledgeBase, error) {
+	kbs := make([]*models.KnowledgeBase, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		kb, err := models.GetKnowledgeBaseByID(id)
+		if err != nil {
+			return nil, apperr.NotFound(apperr.ResourceKnowledgeBase).WithDetail(fmt.Sprint(id))
+		}
+		if !kb.CanAccess(userID) {
+			return nil, apperr.Forbidden(apperr.ResourceKnowledgeBase).WithDetail(fmt.Sprint(id))
+		}
+		kbs = append(kbs, kb)
+	}
+	return kbs, nil
+}
+
+// retrieveCitations 计算query的向量并在知识库中检索最相似的分块
+// 不同知识库可能使用不同的向量模型，按模型分别检索后合并排序
+func retrieveCitations(ctx context.Context, settings config.LLMSettings, kbs []*models.KnowledgeBase, query string) ([]config.Citation, error) {
+	byModel := make(map[string][]uint)
+	for _, kb := range kbs {
+		byModel[kb.EmbeddingModel] = append(byModel[kb.EmbeddingModel], kb.ID)
+	}
+
+	var matches []models.ChunkMatch
+	for model, ids := range byModel {
+		resp, err := embedTexts(ctx, settings, model, []string{query})
+		if err != nil {
+			return nil, err
+		}
+		found, err := models.SearchChunks(ids, resp.Embeddings[0], settings.RAG.TopK, settings.RAG.MinScore)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > settings.RAG.TopK {
+		matches = matches[:settings.RAG.TopK]
+	}
+
+	citations := make([]config.Citation, 0, len(matches))
+	for i, match := range matches {
+		citations = append(citations, config.Citation{
+			Index:           i + 1,
+			KnowledgeBaseID: match.Chunk.KnowledgeBaseID,
+			DocumentID:      match.Chunk.DocumentID,
+			Filename:        match.Filename,
+			ChunkIndex:      match.Chunk.ChunkIndex,
+			Score:           match.Score,
+			Content:         match.Chunk.Content,
+		})
+	}
+	return citations, nil
+}
+
+// lastUserMessage 返回最后一条用户消息的内容，作为检索的查询
+func lastUserMessage(messages []config.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/middleware"
 )
 
 // ModelInfo 模型信息结构
@@ -18,74 +20,92 @@ type ModelInfo struct {
 // ModelsResponse Ollama API返回的模型列表响应
 type ModelsResponse struct {
 	Models []struct {
-		Name      string `json:"name"`
-		Model     string `json:"model"`
+		Name       string `json:"name"`
+		Model      string `json:"model"`
 		ModifiedAt string `json:"modified_at"`
-		Size      int64  `json:"size"`
-		Digest    string `json:"digest"`
-		Details   struct {
-			ParentModel      string   `json:"parent_model"`
-			Format           string   `json:"format"`
-			Family           string   `json:"family"`
-			Families         []string `json:"families"`
-			ParameterSize    string   `json:"parameter_size"`
+		Size       int64  `json:"size"`
+		Digest     string `json:"digest"`
+		Details    struct {
+			ParentModel       string   `json:"parent_model"`
+			Format            string   `json:"format"`
+			Family            string   `json:"family"`
+			Families          []string `json:"families"`
+			ParameterSize     string   `json:"parameter_size"`
 			QuantizationLevel string   `json:"quantization_level"`
 		} `json:"details"`
 	} `json:"models"`
 }
 
-// GetModels 获取本地模型列表
+// GetModels 获取本地模型列表，汇总所有健康后端提供的模型
 func GetModels(c *gin.Context) {
-	// 从环境变量获取LLM API URL的基础部分
-	apiURLBase := os.Getenv("LLM_API_URL")
-	if apiURLBase == "" {
-		apiURLBase = "http://localhost:11434/api"
-	} else {
-		// 如果环境变量中的URL包含/chat/，则去掉这部分，只保留基础URL
-		apiURLBase = strings.TrimSuffix(apiURLBase, "/chat/")
-		apiURLBase = strings.TrimSuffix(apiURLBase, "/chat")
+	// 获取后端池
+	settings := middleware.GetConfig(c).LLM
+	pool := config.NewLLMClient(settings).Pool
+
+	// 创建HTTP客户端
+	client := &http.Client{Timeout: time.Second * 10}
+
+	// 依次获取每个后端的模型列表
+	var modelNames []string
+	seen := make(map[string]bool)
+	var lastErr error
+	for _, backend := range pool.Backends() {
+		names, err := fetchBackendModels(client, backend)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, name := range names {
+			// 只返回配置中允许使用的模型
+			if !seen[name] && settings.ModelAllowed(name) {
+				seen[name] = true
+				modelNames = append(modelNames, name)
+			}
+		}
 	}
 
-	// 构建获取模型列表的URL
-	modelsURL := apiURLBase + "/tags"
+	// 所有后端都不可用时返回错误
+	if modelNames == nil && lastErr != nil {
+		apperr.Respond(c, apperr.ErrListModels.Wrap(lastErr))
+		return
+	}
 
-	// 创建HTTP客户端
-	client := &http.Client{}
+	// 返回模型名称列表
+	c.JSON(http.StatusOK, gin.H{"models": modelNames})
+}
 
+// fetchBackendModels 获取单个后端提供的模型名称，只保留后端配置中声明的模型
+func fetchBackendModels(client *http.Client, backend config.Backend) ([]string, error) {
 	// 创建GET请求
-	req, err := http.NewRequest("GET", modelsURL, nil)
+	req, err := http.NewRequest("GET", backend.TagsURL(), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("创建请求失败: %v", err)})
-		return
+		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	// 发送请求
 	resp, err := client.Do(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("发送请求失败: %v", err)})
-		return
+		return nil, fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(resp.StatusCode, gin.H{"error": fmt.Sprintf("获取模型列表失败，状态码: %d", resp.StatusCode)})
-		return
+		return nil, fmt.Errorf("后端%s返回状态码: %d", backend.Name, resp.StatusCode)
 	}
 
 	// 解析响应
 	var modelsResp ModelsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("解析响应失败: %v", err)})
-		return
+		return nil, fmt.Errorf("解析响应失败: %v", err)
 	}
 
 	// 提取模型名称
 	var modelNames []string
 	for _, model := range modelsResp.Models {
-		modelNames = append(modelNames, model.Name)
+		if backend.Serves(model.Name) {
+			modelNames = append(modelNames, model.Name)
+		}
 	}
-
-	// 返回模型名称列表
-	c.JSON(http.StatusOK, gin.H{"models": modelNames})
-}
\ No newline at end of file
+	return modelNames, nil
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// PreferencesInput 更新用户偏好的请求结构
+type PreferencesInput struct {
+	Options map[string]interface{} `json:"options"` // 模型参数偏好，使用Ollama参数名
+}
+
+// GetPreferences 获取当前用户的模型参数偏好
+func GetPreferences(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 查询用户
+	user, err := models.FindUserByID(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceUser))
+		return
+	}
+
+	// 解析偏好
+	options, err := user.GetPreferences()
+	if err != nil {
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"options": options})
+}
+
+// UpdatePreferences 更新当前用户的模型参数偏好
+func UpdatePreferences(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input PreferencesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 查询用户
+	user, err := models.FindUserByID(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceUser))
+		return
+	}
+
+	// 只保存Ollama支持的参数
+	options := config.NormalizeOptions(input.Options)
+	if err := user.SetPreferences(options); err != nil {
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Model(user).Update("preferences", user.Preferences).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourcePreferences, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户偏好保存成功", "options": options})
+}
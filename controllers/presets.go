@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// PresetInput 创建或更新提示词预设的请求结构
+type PresetInput struct {
+	Name         string                 `json:"name" binding:"required"`
+	SystemPrompt string                 `json:"system_prompt"`
+	DefaultModel string                 `json:"default_model"`
+	Options      map[string]interface{} `json:"options"`
+	Shared       bool                   `json:"shared"` // 是否共享给所有用户
+}
+
+// presetResponse 构建提示词预设的响应数据
+func presetResponse(preset *models.PromptPreset) gin.H {
+	options, _ := preset.GetOptions()
+	return gin.H{
+		"id":            preset.ID,
+		"name":          preset.Name,
+		"system_prompt": preset.SystemPrompt,
+		"default_model": preset.DefaultModel,
+		"options":       options,
+		"user_id":       preset.UserID,
+		"shared":        preset.Shared,
+		"created_at":    preset.CreatedAt,
+		"updated_at":    preset.UpdatedAt,
+	}
+}
+
+// ListPresets 获取当前用户可用的提示词预设（自己的和共享的）
+func ListPresets(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 查询预设
+	presets, err := models.GetAccessiblePromptPresets(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourcePreset, err))
+		return
+	}
+
+	responsePresets := make([]gin.H, 0, len(presets))
+	for i := range presets {
+		responsePresets = append(responsePresets, presetResponse(&presets[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"presets": responsePresets})
+}
+
+// CreatePreset 创建提示词预设
+func CreatePreset(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input PresetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 创建预设
+	preset := models.PromptPreset{UserID: userID}
+	if err := applyPresetInput(&preset, &input); err != nil {
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Create(&preset).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourcePreset, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词预设创建成功", "preset": presetResponse(&preset)})
+}
+
+// GetPreset 获取提示词预设详情
+func GetPreset(c *gin.Context) {
+	preset, ok := loadPreset(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preset": presetResponse(preset)})
+}
+
+// UpdatePreset 更新提示词预设，只有创建者可以修改
+func UpdatePreset(c *gin.Context) {
+	preset, ok := loadPreset(c, true)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input PresetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	if err := applyPresetInput(preset, &input); err != nil {
+		apperr.Respond(c, apperr.ErrInternal.Wrap(err))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Save(preset).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpUpdate, apperr.ResourcePreset, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词预设更新成功", "preset": presetResponse(preset)})
+}
+
+// DeletePreset 删除提示词预设，只有创建者可以删除
+func DeletePreset(c *gin.Context) {
+	preset, ok := loadPreset(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.DeletePromptPreset(preset.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourcePreset, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词预设删除成功"})
+}
+
+// applyPresetInput 将请求数据写入预设
+func applyPresetInput(preset *models.PromptPreset, input *PresetInput) error {
+	preset.Name = input.Name
+	preset.SystemPrompt = input.SystemPrompt
+	preset.DefaultModel = input.DefaultModel
+	preset.Shared = input.Shared
+	return preset.SetOptions(config.NormalizeOptions(input.Options))
+}
+
+// loadPreset 根据路径参数加载预设并检查权限，owner为true时要求当前用户是创建者
+func loadPreset(c *gin.Context, owner bool) (*models.PromptPreset, bool) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
+	}
+
+	// 获取预设ID
+	presetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourcePreset))
+		return nil, false
+	}
+
+	// 查询预设
+	preset, err := models.GetPromptPresetByID(uint(presetID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourcePreset))
+		return nil, false
+	}
+
+	// 验证权限
+	if (owner && preset.UserID != userID) || !preset.CanAccess(userID) {
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourcePreset))
+		return nil, false
+	}
+
+	return preset, true
+}
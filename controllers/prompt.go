@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"github.com/trae-ds-go-backend/config"
+)
+
+// summaryPrefix 对话摘要系统消息的前缀
+const summaryPrefix = "以下是之前对话的摘要：\n"
+
+// promptBuilder 构建实际发送给模型的消息，同时记录每条消息在请求messages中的下标
+type promptBuilder struct {
+	messages []config.Message
+	origin   []int // 对应请求messages中的下标，服务器插入的消息为-1
+}
+
+// newPromptBuilder 以请求中的消息创建构建器
+func newPromptBuilder(messages []config.Message) *promptBuilder {
+	origin := make([]int, len(messages))
+	for i := range messages {
+		origin[i] = i
+	}
+	return &promptBuilder{messages: messages, origin: origin}
+}
+
+// prepend 在最前面插入一条服务器生成的消息
+func (b *promptBuilder) prepend(message config.Message) {
+	b.messages = append([]config.Message{message}, b.messages...)
+	b.origin = append([]int{-1}, b.origin...)
+}
+
+// summarize 用摘要替换前count条消息，其中的系统消息保留，摘要作为系统消息插入在它们之后
+func (b *promptBuilder) summarize(count int, summary string) {
+	if count <= 0 || count > len(b.messages) {
+		return
+	}
+
+	messages := make([]config.Message, 0, len(b.messages)-count+1)
+	origin := make([]int, 0, len(b.messages)-count+1)
+	for i := 0; i < count; i++ {
+		if b.messages[i].Role == "system" {
+			messages = append(messages, b.messages[i])
+			origin = append(origin, b.origin[i])
+		}
+	}
+	messages = append(messages, config.Message{Role: "system", Content: summaryPrefix + summary})
+	origin = append(origin, -1)
+
+	b.messages = append(messages, b.messages[count:]...)
+	b.origin = append(origin, b.origin[count:]...)
+}
+
+// fit 按上下文窗口截断消息，返回的省略下标以请求中的messages为准
+func (b *promptBuilder) fit(budget int, strategy string) ([]config.Message, config.ContextReport, error) {
+	messages, report, err := config.FitContext(b.messages, budget, strategy)
+	if err != nil {
+		return nil, report, err
+	}
+
+	omitted := make([]int, 0, len(report.Omitted))
+	for _, i := range report.Omitted {
+		if b.origin[i] >= 0 {
+			omitted = append(omitted, b.origin[i])
+		}
+	}
+	report.Omitted = omitted
+	return messages, report, nil
+}
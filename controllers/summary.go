@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// summarizing 正在生成摘要的历史记录ID，避免同一对话并发生成摘要
+var summarizing sync.Map
+
+// summaryWG 跟踪后台生成摘要的goroutine，服务关闭时等待它们结束后再关闭数据库
+var summaryWG sync.WaitGroup
+
+// ownedHistory 获取属于用户的聊天历史记录，不存在或不属于该用户时返回nil
+func ownedHistory(historyID string, userID uint) *models.ChatHistory {
+	if historyID == "" {
+		return nil
+	}
+	history, err := models.GetChatHistoryByHistoryID(historyID)
+	if err != nil || history.UserID != userID {
+		return nil
+	}
+	return history
+}
+
+// applyHistorySummary 请求消息的开头与摘要覆盖的消息一致时，用摘要替换这些消息，返回被替换的消息数
+func applyHistorySummary(prompt *promptBuilder, history *models.ChatHistory, messages []config.Message) int {
+	count := history.SummarizedCount
+	if history.Summary == "" || count <= 0 || count >= len(messages) {
+		return 0
+	}
+	if config.MessagesDigest(messages[:count]) != history.SummaryDigest {
+		return 0
+	}
+	prompt.summarize(count, history.Summary)
+	return count
+}
+
+// maybeSummarize 对话保存后在后台检查是否需要更新摘要
+func maybeSummarize(settings config.LLMSettings, historyID string) {
+	if !settings.Summary.Enabled || historyID == "" {
+		return
+	}
+	if _, busy := summarizing.LoadOrStore(historyID, true); busy {
+		return
+	}
+	summaryWG.Add(1)
+	go func() {
+		defer summaryWG.Done()
+		defer summarizing.Delete(historyID)
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("生成对话摘要时发生panic", "history_id", historyID, "panic", r, "stack", string(debug.Stack()))
+			}
+		}()
+		if err := summarizeHistory(settings, historyID); err != nil {
+			slog.Warn("生成对话摘要失败", "history_id", historyID, "error", err)
+		}
+	}()
+}
+
+// WaitSummaries 等待后台生成的对话摘要全部结束，ctx到期时返回ctx的错误
+func WaitSummaries(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		summaryWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// summarizeHistory 将未被摘要的较早消息与之前的摘要合并成新的摘要，最近的消息保留原文
+func summarizeHistory(settings config.LLMSettings, historyID string) error {
+	history, err := models.GetChatHistoryByHistoryID(historyID)
+	if err != nil {
+		return err
+	}
+	var messages []config.Message
+	if err := json.Unmarshal([]byte(history.Messages), &messages); err != nil {
+		return err
+	}
+
+	// 摘要覆盖的消息被修改过（如重新生成、编辑）时从头生成
+	start, previous := history.SummarizedCount, history.Summary
+	if start > len(messages) || config.MessagesDigest(messages[:start]) != history.SummaryDigest {
+		start, previous = 0, ""
+	}
+	if len(messages)-start <= settings.Summary.Threshold {
+		return nil
+	}
+
+	// 保留原文的部分从用户消息开始，keep_recent为0时摘要全部消息
+	end := len(messages) - settings.Summary.KeepRecent
+	for end > start && end < len(messages) && messages[end].Role != "user" {
+		end--
+	}
+	if end <= start {
+		return nil
+	}
+
+	model := settings.Summary.Model
+	if model == "" {
+		model = history.ModelName
+	}
+	options := map[string]interface{}{
+		"num_predict": settings.Summary.MaxTokens,
+		"temperature": 0.3,
+	}
+	client := config.NewLLMClient(settings)
+	response, err := client.Chat(config.SummaryPrompt(previous, messages[start:end]), options, model, config.ChatParams{})
+	if err != nil {
+		return err
+	}
+	_, summary := config.SplitReasoning(response.Message.Content)
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return errors.New("模型返回的摘要为空")
+	}
+
+	return models.UpdateChatHistorySummary(history.ID, summary, end, config.MessagesDigest(messages[:end]))
+}
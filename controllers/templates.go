@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// TemplateInput 创建或更新提示词模板的请求结构
+type TemplateInput struct {
+	Name        string                    `json:"name" binding:"required"`
+	Description string                    `json:"description"`
+	Content     string                    `json:"content" binding:"required"`
+	Variables   []models.TemplateVariable `json:"variables"`
+	Shared      bool                      `json:"shared"` // 是否共享给所有用户
+}
+
+// RenderTemplateInput 渲染提示词模板的请求结构
+type RenderTemplateInput struct {
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// templateResponse 构建提示词模板的响应数据
+func templateResponse(tmpl *models.PromptTemplate) gin.H {
+	variables, _ := tmpl.GetVariables()
+	return gin.H{
+		"id":          tmpl.ID,
+		"name":        tmpl.Name,
+		"description": tmpl.Description,
+		"content":     tmpl.Content,
+		"variables":   variables,
+		"user_id":     tmpl.UserID,
+		"shared":      tmpl.Shared,
+		"created_at":  tmpl.CreatedAt,
+		"updated_at":  tmpl.UpdatedAt,
+	}
+}
+
+// ListTemplates 获取当前用户可用的提示词模板（自己的和共享的）
+func ListTemplates(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 查询模板
+	templates, err := models.GetAccessiblePromptTemplates(userID)
+	if err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpGet, apperr.ResourceTemplate, err))
+		return
+	}
+
+	responseTemplates := make([]gin.H, 0, len(templates))
+	for i := range templates {
+		responseTemplates = append(responseTemplates, templateResponse(&templates[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": responseTemplates})
+}
+
+// CreateTemplate 创建提示词模板
+func CreateTemplate(c *gin.Context) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return
+	}
+
+	// 绑定请求数据
+	var input TemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	// 创建并校验模板
+	tmpl := models.PromptTemplate{UserID: userID}
+	if err := applyTemplateInput(&tmpl, &input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidTemplate.WithDetail(err.Error()))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Create(&tmpl).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpSave, apperr.ResourceTemplate, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词模板创建成功", "template": templateResponse(&tmpl)})
+}
+
+// GetTemplate 获取提示词模板详情
+func GetTemplate(c *gin.Context) {
+	tmpl, ok := loadTemplate(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": templateResponse(tmpl)})
+}
+
+// UpdateTemplate 更新提示词模板，只有创建者可以修改
+func UpdateTemplate(c *gin.Context) {
+	tmpl, ok := loadTemplate(c, true)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input TemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	if err := applyTemplateInput(tmpl, &input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidTemplate.WithDetail(err.Error()))
+		return
+	}
+
+	// 保存到数据库
+	if err := models.DB.Save(tmpl).Error; err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpUpdate, apperr.ResourceTemplate, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词模板更新成功", "template": templateResponse(tmpl)})
+}
+
+// DeleteTemplate 删除提示词模板，只有创建者可以删除
+func DeleteTemplate(c *gin.Context) {
+	tmpl, ok := loadTemplate(c, true)
+	if !ok {
+		return
+	}
+
+	if err := models.DeletePromptTemplate(tmpl.ID); err != nil {
+		apperr.Respond(c, apperr.Failed(apperr.OpDelete, apperr.ResourceTemplate, err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "提示词模板删除成功"})
+}
+
+// RenderTemplate 使用变量渲染提示词模板
+func RenderTemplate(c *gin.Context) {
+	tmpl, ok := loadTemplate(c, false)
+	if !ok {
+		return
+	}
+
+	// 绑定请求数据
+	var input RenderTemplateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		apperr.Respond(c, apperr.ErrInvalidRequest)
+		return
+	}
+
+	content, err := tmpl.Render(input.Variables)
+	if err != nil {
+		apperr.Respond(c, apperr.ErrRenderTemplate.WithDetail(err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"content": content})
+}
+
+// applyTemplateInput 将请求数据写入模板并校验模板定义
+func applyTemplateInput(tmpl *models.PromptTemplate, input *TemplateInput) error {
+	tmpl.Name = input.Name
+	tmpl.Description = input.Description
+	tmpl.Content = input.Content
+	tmpl.Shared = input.Shared
+	if err := tmpl.SetVariables(input.Variables); err != nil {
+		return err
+	}
+	return tmpl.ValidateDefinition()
+}
+
+// loadTemplate 根据路径参数加载模板并检查权限，owner为true时要求当前用户是创建者
+func loadTemplate(c *gin.Context, owner bool) (*models.PromptTemplate, bool) {
+	// 获取用户ID
+	userIDInterface, exists := c.Get("user_id")
+	if !exists {
+		apperr.Respond(c, apperr.ErrUnauthorized)
+		return nil, false
+	}
+	userID, ok := userIDInterface.(uint)
+	if !ok {
+		apperr.Respond(c, apperr.ErrInternal)
+		return nil, false
+	}
+
+	// 获取模板ID
+	templateID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperr.Respond(c, apperr.InvalidID(apperr.ResourceTemplate))
+		return nil, false
+	}
+
+	// 查询模板
+	tmpl, err := models.GetPromptTemplateByID(uint(templateID))
+	if err != nil {
+		apperr.Respond(c, apperr.NotFound(apperr.ResourceTemplate))
+		return nil, false
+	}
+
+	// 验证权限
+	if (owner && tmpl.UserID != userID) || !tmpl.CanAccess(userID) {
+		apperr.Respond(c, apperr.Forbidden(apperr.ResourceTemplate))
+		return nil, false
+	}
+
+	return tmpl, true
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/tools"
+)
+
+// resolveTools 校验请求启用的工具并构建发送给模型的工具定义
+func resolveTools(names []string, settings config.ToolSettings) ([]config.ToolDefinition, error) {
+	definitions := make([]config.ToolDefinition, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		tool, ok := tools.Get(name)
+		if !ok || !settings.ToolAllowed(name) {
+			return nil, apperr.ErrToolNotAllowed.With(name)
+		}
+		definitions = append(definitions, tools.Definition(tool))
+	}
+	return definitions, nil
+}
+
+// errToolNotEnabled 模型请求调用的工具不在本次请求启用的工具中
+var errToolNotEnabled = errors.New("工具未启用")
+
+// toolOffered 判断工具是否在本次请求提供给模型的工具定义中
+func toolOffered(definitions []config.ToolDefinition, name string) bool {
+	for _, definition := range definitions {
+		if definition.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runToolCalls 执行模型请求的工具调用，每次调用以tool事件发送给客户端
+// 返回追加了assistant和tool消息的提示词，调用过程同时保存在req.ToolMessages中
+func runToolCalls(rc *ResponseCollector, req *chatRequest, messages []config.Message, round int) ([]config.Message, error) {
+	// 本轮生成的内容和工具调用作为一条assistant消息
+	calls := rc.ToolCalls
+	assistant := config.Message{
+		Role:      "assistant",
+		Content:   rc.ResponseContent,
+		Reasoning: strings.TrimSpace(rc.ReasoningContent),
+		ToolCalls: calls,
+	}
+	rc.reset()
+
+	results := make([]config.Message, 0, len(calls))
+	for _, call := range calls {
+		// 只执行本次请求提供给模型的工具，模型编造的或被禁用的工具不执行
+		var result string
+		err := errToolNotEnabled
+		if toolOffered(req.Tools, call.Function.Name) {
+			result, err = tools.Execute(tools.Context{UserID: req.UserID}, call)
+		}
+		event := gin.H{
+			"round":     round,
+			"name":      call.Function.Name,
+			"arguments": call.Function.Arguments,
+		}
+		if err != nil {
+			// 工具执行失败时将错误告诉模型，由模型决定如何继续
+			result = "工具调用失败: " + err.Error()
+			event["error"] = err.Error()
+		} else {
+			event["result"] = result
+		}
+		if _, err := rc.writeEvent("tool", event); err != nil {
+			return nil, err
+		}
+		rc.Flush()
+		results = append(results, config.Message{Role: "tool", Content: result, ToolName: call.Function.Name})
+	}
+	req.ToolMessages = append(append(req.ToolMessages, assistant), results...)
+
+	// 发送给模型的消息不包含推理内容
+	assistant.Reasoning = ""
+	return append(append(messages[:len(messages):len(messages)], assistant), results...), nil
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/trae-ds-go-backend/config"
 	"github.com/trae-ds-go-backend/controllers"
 	"github.com/trae-ds-go-backend/middleware"
 	"github.com/trae-ds-go-backend/models"
@@ -13,38 +20,186 @@ import (
 
 func main() {
 	// 加载环境变量
-	err := godotenv.Load()
+	envErr := godotenv.Load()
+
+	// 加载并校验配置
+	store, err := config.NewStore("")
+	if err != nil {
+		slog.Error("加载配置失败", "error", err)
+		os.Exit(1)
+	}
+	cfg := store.Get()
+
+	// 初始化日志，配置热加载后同步更新日志级别和格式
+	config.SetupLogging(cfg.Log, cfg.Server.Mode)
+	if envErr != nil {
+		slog.Info("未找到.env文件，使用默认环境变量")
+	}
+
+	// 初始化链路追踪，退出前刷新尚未导出的span
+	shutdownTracing, err := config.SetupTracing(cfg.Tracing)
 	if err != nil {
-		log.Println("未找到.env文件，使用默认环境变量")
+		slog.Error("初始化链路追踪失败", "error", err)
+		os.Exit(1)
 	}
 
 	// 初始化数据库
-	models.ConnectDatabase()
+	models.ConnectDatabase(cfg.Database.Path, cfg.Server.Mode == gin.ReleaseMode)
+
+	// 初始化LLM后端池并启动健康检查
+	if err := config.InitBackendPool(context.Background(), cfg.LLM); err != nil {
+		slog.Error("初始化LLM后端失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 配置热加载后更新后端池
+	store.OnReload(func(cfg *config.AppConfig) {
+		config.SetupLogging(cfg.Log, cfg.Server.Mode)
+		if err := config.DefaultPool.Update(cfg.LLM.Backends); err != nil {
+			slog.Error("更新LLM后端失败", "error", err)
+		}
+	})
+	watchReload(store)
+
+	// 定期清理过期的审计日志
+	purgeAuditLogs(store)
 
 	// 设置Gin模式
-	gin.SetMode(getGinMode())
+	gin.SetMode(cfg.Server.Mode)
 
 	// 创建Gin路由
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.RequestLogger(), middleware.Tracing(), middleware.Metrics(), gin.Recovery())
 
 	// 注册路由
-	setupRoutes(r)
+	setupRoutes(r, store)
 
-	// 获取端口
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// 暴露监控指标，配置了单独的监听地址时不与API共用端口
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Listen == "" {
+			r.GET("/metrics", gin.WrapH(middleware.MetricsHandler(cfg.Metrics.Token)))
+		} else {
+			serveMetrics(cfg.Metrics)
+		}
 	}
 
 	// 启动服务器
-	log.Printf("服务器运行在 http://localhost:%s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("无法启动服务器: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("无法启动服务器", "error", err)
+			os.Exit(1)
+		}
+	}()
+	slog.Info("服务器已启动", "address", "http://localhost:"+cfg.Server.Port)
+
+	// 收到SIGINT或SIGTERM后停止接收新请求，等待进行中的请求完成
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	slog.Info("正在关闭服务器", "timeout", cfg.Server.ShutdownTimeout)
+	shutdown(srv, cfg.Server.ShutdownTimeout)
+
+	// 关闭数据库连接并导出剩余的span
+	if err := models.CloseDatabase(); err != nil {
+		slog.Error("关闭数据库失败", "error", err)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("导出链路追踪数据失败", "error", err)
 	}
+	slog.Info("服务器已关闭")
+}
+
+// shutdownGrace 中断模型请求后等待请求保存部分回复并结束的时间
+const shutdownGrace = time.Second * 5
+
+// shutdown 优雅关闭服务器：停止接收新请求并等待进行中的请求和后台摘要完成
+// 超过timeout后中断仍在进行的模型请求，流式请求会保存已生成的部分回复后结束
+func shutdown(srv *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	serverErr := srv.Shutdown(ctx)
+	if serverErr == nil && controllers.WaitSummaries(ctx) == nil {
+		return
+	}
+
+	slog.Warn("等待请求完成超时，中断进行中的模型请求")
+	config.CutOffRequests()
+	graceCtx, graceCancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer graceCancel()
+	if serverErr != nil {
+		if err := srv.Shutdown(graceCtx); err != nil {
+			slog.Error("仍有请求未结束，强制关闭连接", "error", err)
+			srv.Close()
+		}
+	}
+	// 被中断的摘要请求会很快返回，等待它们结束后再关闭数据库
+	if err := controllers.WaitSummaries(graceCtx); err != nil {
+		slog.Error("仍有对话摘要未完成", "error", err)
+	}
+}
+
+// watchReload 收到SIGHUP信号时重新加载配置
+func watchReload(store *config.Store) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := store.Reload(); err != nil {
+				slog.Error("重新加载配置失败，继续使用原配置", "error", err)
+				continue
+			}
+			slog.Info("配置已重新加载")
+		}
+	}()
+}
+
+// serveMetrics 在单独的端口上暴露监控指标
+func serveMetrics(cfg config.MetricsConfig) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", middleware.MetricsHandler(cfg.Token))
+	go func() {
+		slog.Info("监控指标已启动", "address", cfg.Listen)
+		if err := http.ListenAndServe(cfg.Listen, mux); err != nil {
+			slog.Error("无法启动监控指标服务", "error", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// purgeAuditLogs 启动后台任务，每小时删除超过保留时长的审计日志，保留时长随配置热加载生效
+func purgeAuditLogs(store *config.Store) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if retention := store.Get().Audit.Retention; retention > 0 {
+				count, err := models.PurgeAuditLogs(time.Now().Add(-retention))
+				if err != nil {
+					slog.Error("清理审计日志失败", "error", err)
+				} else if count > 0 {
+					slog.Info("已清理过期的审计日志", "count", count)
+				}
+			}
+			<-ticker.C
+		}
+	}()
 }
 
 // 设置路由
-func setupRoutes(r *gin.Engine) {
+func setupRoutes(r *gin.Engine, store *config.Store) {
+	// 注入配置
+	r.Use(middleware.InjectConfig(store))
+
+	// 健康检查路由，供容器编排探测使用
+	r.GET("/healthz", controllers.Healthz)
+	r.GET("/readyz", controllers.Readyz)
+
 	// 公开路由
 	public := r.Group("/api")
 	{
@@ -55,23 +210,83 @@ func setupRoutes(r *gin.Engine) {
 
 	// 需要认证的路由
 	protected := r.Group("/api")
-	protected.Use(middleware.JWTAuth())
+	protected.Use(middleware.JWTAuth(store.Get().Auth))
 	{
-		protected.POST("/stream-chat", controllers.StreamChat) // 添加流式聊天路由
-		
+		protected.POST("/chat", controllers.Chat)                             // 非流式聊天路由
+		protected.POST("/stream-chat", controllers.StreamChat)                // 添加流式聊天路由
+		protected.POST("/stream-chat/compare", controllers.StreamChatCompare) // 多模型对比路由
+		protected.POST("/embeddings", controllers.Embeddings)                 // 向量嵌入路由
+
+		// 提示词预设相关路由
+		protected.GET("/presets", controllers.ListPresets)
+		protected.POST("/presets", controllers.CreatePreset)
+		protected.GET("/presets/:id", controllers.GetPreset)
+		protected.PUT("/presets/:id", controllers.UpdatePreset)
+		protected.DELETE("/presets/:id", controllers.DeletePreset)
+
+		// 提示词模板相关路由
+		protected.GET("/templates", controllers.ListTemplates)
+		protected.POST("/templates", controllers.CreateTemplate)
+		protected.GET("/templates/:id", controllers.GetTemplate)
+		protected.PUT("/templates/:id", controllers.UpdateTemplate)
+		protected.DELETE("/templates/:id", controllers.DeleteTemplate)
+		protected.POST("/templates/:id/render", controllers.RenderTemplate)
+
+		// 知识库相关路由
+		protected.GET("/knowledge-bases", controllers.ListKnowledgeBases)
+		protected.POST("/knowledge-bases", controllers.CreateKnowledgeBase)
+		protected.GET("/knowledge-bases/:id", controllers.GetKnowledgeBase)
+		protected.PUT("/knowledge-bases/:id", controllers.UpdateKnowledgeBase)
+		protected.DELETE("/knowledge-bases/:id", controllers.DeleteKnowledgeBase)
+		protected.POST("/knowledge-bases/:id/documents", controllers.UploadDocument)
+		protected.DELETE("/knowledge-bases/:id/documents/:document_id", controllers.DeleteDocument)
+		protected.POST("/knowledge-bases/:id/search", controllers.SearchKnowledgeBase)
+
+		// 附件相关路由
+		protected.GET("/attachments", controllers.ListAttachments)
+		protected.POST("/attachments", controllers.UploadAttachment)
+		protected.GET("/attachments/:id", controllers.GetAttachment)
+		protected.DELETE("/attachments/:id", controllers.DeleteAttachment)
+
+		// 用户偏好相关路由
+		protected.GET("/user/preferences", controllers.GetPreferences)
+		protected.PUT("/user/preferences", controllers.UpdatePreferences)
+
 		// 聊天历史记录相关路由
 		protected.POST("/chat-history", controllers.SaveChatHistory)
 		protected.GET("/chat-histories", controllers.GetUserChatHistories)
 		protected.GET("/chat-history/:history_id", controllers.GetChatHistoryDetail)
 		protected.DELETE("/chat-history/:id", controllers.DeleteChatHistory)
+
+		// 回复评价相关路由
+		protected.GET("/feedback", controllers.ListFeedback)
+		protected.POST("/feedback", controllers.CreateFeedback)
+		protected.GET("/feedback/:id", controllers.GetFeedback)
+		protected.PUT("/feedback/:id", controllers.UpdateFeedback)
+		protected.DELETE("/feedback/:id", controllers.DeleteFeedback)
+
+		// 多模型对比结果相关路由
+		protected.GET("/compare-groups/:group_id", controllers.GetCompareGroup)
+		protected.POST("/compare-groups/:group_id/winner", controllers.PickCompareWinner)
+
+		// 服务状态，仅管理员可用
+		protected.GET("/status", middleware.AdminOnly(store.Get().Auth), controllers.GetStatus)
 	}
-}
 
-// 获取Gin模式
-func getGinMode() string {
-	mode := os.Getenv("GIN_MODE")
-	if mode == "" {
-		return gin.DebugMode
+	// 管理员路由
+	admin := r.Group("/api/admin")
+	admin.Use(middleware.JWTAuth(store.Get().Auth), middleware.AdminOnly(store.Get().Auth))
+	{
+		admin.GET("/feedback/report", controllers.FeedbackReport)
+		admin.GET("/feedback/export", controllers.ExportPreferences)
+		admin.GET("/audit-logs", controllers.ListAuditLogs)
+		admin.GET("/audit-logs/:id", controllers.GetAuditLog)
 	}
-	return mode
-}
\ No newline at end of file
+
+	// OpenAI兼容的路由，使用相同的认证
+	openai := r.Group("/v1")
+	openai.Use(middleware.JWTAuth(store.Get().Auth))
+	{
+		openai.POST("/embeddings", controllers.OpenAIEmbeddings)
+	}
+}
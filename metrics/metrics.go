@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace 所有指标名称的前缀
+const namespace = "trae_ds"
+
+var (
+	// HTTPRequests 按路由统计的HTTP请求数
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "按路由、方法和状态码统计的HTTP请求数",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration 按路由统计的HTTP请求耗时，流式请求包含整个流的时长
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "按路由和方法统计的HTTP请求耗时",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method", "route"})
+
+	// ActiveStreams 正在进行的流式模型请求数
+	ActiveStreams = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "llm_active_streams",
+		Help:      "正在进行的流式模型请求数",
+	}, []string{"model"})
+
+	// TimeToFirstToken 从发送流式请求到收到第一段生成内容的耗时
+	TimeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_time_to_first_token_seconds",
+		Help:      "流式请求从发送到收到第一段生成内容的耗时",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60},
+	}, []string{"model"})
+
+	// TokensPerSecond 流式生成速度，按第一段内容到结束的时间计算
+	TokensPerSecond = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_per_second",
+		Help:      "流式请求从第一段生成内容到结束的生成速度",
+		Buckets:   []float64{1, 2, 5, 10, 20, 30, 50, 75, 100, 150, 200},
+	}, []string{"model"})
+
+	// UpstreamErrors 按后端统计的模型请求错误数
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_upstream_errors_total",
+		Help:      "按后端和原因统计的模型请求错误数",
+	}, []string{"backend", "reason"})
+
+	// DBQueryDuration 按操作和表统计的数据库查询耗时
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "按操作和表统计的数据库查询耗时",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"operation", "table"})
+)
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// AdminOnly 管理员权限中间件，需要在JWTAuth之后使用
+func AdminOnly(auth config.AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 获取用户ID
+		userIDInterface, exists := c.Get("user_id")
+		if !exists {
+			apperr.Abort(c, apperr.ErrUnauthorized)
+			return
+		}
+		userID, ok := userIDInterface.(uint)
+		if !ok {
+			apperr.Abort(c, apperr.ErrInternal)
+			return
+		}
+
+		// 检查用户是否在管理员列表中
+		user, err := models.FindUserByID(userID)
+		if err != nil || !auth.IsAdmin(user.Username) {
+			apperr.Abort(c, apperr.ErrAdminRequired)
+			return
+		}
+		c.Next()
+	}
+}
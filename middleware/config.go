@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/trae-ds-go-backend/config"
+)
+
+// ConfigKey 上下文中保存配置的键名
+const ConfigKey = "config"
+
+// InjectConfig 将当前生效的配置注入到请求上下文中
+// 每个请求在开始时获取一份配置快照，热加载不会影响正在处理的请求
+func InjectConfig(store *config.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ConfigKey, store.Get())
+		c.Next()
+	}
+}
+
+// GetConfig 从请求上下文中获取配置
+func GetConfig(c *gin.Context) *config.AppConfig {
+	if cfg, ok := c.Get(ConfigKey); ok {
+		if appConfig, ok := cfg.(*config.AppConfig); ok {
+			return appConfig
+		}
+	}
+	return config.DefaultAppConfig()
+}
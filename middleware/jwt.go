@@ -2,32 +2,30 @@ package middleware
 
 import (
 	"fmt"
-	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/trae-ds-go-backend/apperr"
+	"github.com/trae-ds-go-backend/config"
 	"github.com/trae-ds-go-backend/models"
 )
 
 // JWTAuth JWT认证中间件
-func JWTAuth() gin.HandlerFunc {
+func JWTAuth(auth config.AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头获取token
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供认证令牌"})
-			c.Abort()
+			apperr.Abort(c, apperr.ErrTokenMissing)
 			return
 		}
 
 		// 检查token格式
 		parts := strings.SplitN(authHeader, " ", 2)
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证格式无效"})
-			c.Abort()
+			apperr.Abort(c, apperr.ErrTokenMalformed)
 			return
 		}
 
@@ -40,18 +38,11 @@ func JWTAuth() gin.HandlerFunc {
 				return nil, fmt.Errorf("无效的签名方法: %v", token.Header["alg"])
 			}
 
-			// 获取密钥
-			jwtSecret := os.Getenv("JWT_SECRET")
-			if jwtSecret == "" {
-				jwtSecret = "default_jwt_secret" // 默认密钥，生产环境应该使用环境变量
-			}
-
-			return []byte(jwtSecret), nil
+			return []byte(auth.JWTSecret), nil
 		})
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
-			c.Abort()
+			apperr.Abort(c, apperr.ErrTokenInvalid)
 			return
 		}
 
@@ -59,8 +50,7 @@ func JWTAuth() gin.HandlerFunc {
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 			// 检查token是否过期
 			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "认证令牌已过期"})
-				c.Abort()
+				apperr.Abort(c, apperr.ErrTokenExpired)
 				return
 			}
 
@@ -71,29 +61,22 @@ func JWTAuth() gin.HandlerFunc {
 			c.Set("user_id", userID)
 			c.Next()
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
-			c.Abort()
+			apperr.Abort(c, apperr.ErrTokenInvalid)
 			return
 		}
 	}
 }
 
 // GenerateToken 生成JWT令牌
-func GenerateToken(user *models.User) (string, error) {
-	// 获取密钥
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "default_jwt_secret" // 默认密钥，生产环境应该使用环境变量
-	}
-
+func GenerateToken(user *models.User, auth config.AuthConfig) (string, error) {
 	// 创建token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7天过期
+		"exp":     time.Now().Add(auth.TokenTTL).Unix(),
 	})
 
 	// 签名token
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := token.SignedString([]byte(auth.JWTSecret))
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 请求ID在上下文中的键名和对应的请求头
+const (
+	RequestIDKey    = "request_id"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// maxRequestIDLength 客户端提供的请求ID的最大长度，超出时重新生成
+const maxRequestIDLength = 128
+
+// RequestLogger 为每个请求分配请求ID，并在请求结束后记录访问日志
+// 客户端通过X-Request-ID请求头提供的ID会被沿用，响应头中返回实际使用的ID
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.New().String()
+		}
+		c.Set(RequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		started := time.Now()
+		c.Next()
+
+		// 按响应状态选择日志级别
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		Logger(c).Log(c.Request.Context(), level, "请求完成",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", time.Since(started).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"size", c.Writer.Size(),
+		)
+	}
+}
+
+// Logger 返回带有请求ID、用户ID和链路ID的日志记录器
+func Logger(c *gin.Context) *slog.Logger {
+	logger := slog.Default()
+	if requestID, ok := c.Get(RequestIDKey); ok {
+		logger = logger.With(RequestIDKey, requestID)
+	}
+	if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+		logger = logger.With("trace_id", span.TraceID().String())
+	}
+	if userID, ok := c.Get("user_id"); ok {
+		logger = logger.With("user_id", userID)
+	}
+	return logger
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Attachment 用户上传的附件，文件保存在本地磁盘
+type Attachment struct {
+	gorm.Model
+	UserID   uint   `gorm:"not null;index" json:"user_id"`      // 上传者ID
+	Filename string `gorm:"size:255;not null" json:"filename"`  // 原始文件名
+	MimeType string `gorm:"size:100;not null" json:"mime_type"` // 按文件内容识别的MIME类型
+	Size     int64  `gorm:"not null" json:"size"`               // 文件字节数
+	Path     string `gorm:"size:500;not null" json:"-"`         // 相对于存储目录的路径
+	User     User   `gorm:"foreignKey:UserID" json:"-"`         // 关联的用户
+}
+
+// IsImage 判断附件是否为图片
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.MimeType, "image/")
+}
+
+// GetAttachmentByID 通过ID获取附件
+func GetAttachmentByID(id uint) (*Attachment, error) {
+	var attachment Attachment
+	result := DB.First(&attachment, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("附件不存在")
+		}
+		return nil, result.Error
+	}
+	return &attachment, nil
+}
+
+// GetAttachmentsByUserID 获取用户的所有附件
+func GetAttachmentsByUserID(userID uint) ([]Attachment, error) {
+	var attachments []Attachment
+	result := DB.Where("user_id = ?", userID).Order("created_at desc").Find(&attachments)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return attachments, nil
+}
+
+// DeleteAttachment 删除附件记录
+func DeleteAttachment(id uint) error {
+	result := DB.Delete(&Attachment{}, id)
+	return result.Error
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 审计日志中的请求结果
+const (
+	AuditStatusSuccess  = "success"  // 模型正常完成回复
+	AuditStatusError    = "error"    // 模型请求失败
+	AuditStatusCanceled = "canceled" // 客户端在回复完成前断开连接
+)
+
+// AuditLog 聊天请求审计日志，只追加，不提供修改和单条删除，过期记录由保留策略统一清理
+type AuditLog struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+	UserID           uint      `gorm:"not null;index" json:"user_id"`         // 请求用户ID
+	Endpoint         string    `gorm:"size:255;not null" json:"endpoint"`     // 请求的接口路径
+	ModelName        string    `gorm:"size:255;index" json:"model"`           // 请求的模型
+	HistoryID        string    `gorm:"size:255" json:"history_id"`            // 保存的聊天历史ID，可为空
+	RequestHash      string    `gorm:"size:64;index" json:"request_hash"`     // 发送给模型的请求内容的哈希
+	Prompt           string    `gorm:"type:text" json:"prompt,omitempty"`     // 发送给模型的消息，JSON格式存储，按配置脱敏或不记录
+	Completion       string    `gorm:"type:text" json:"completion,omitempty"` // 模型的回复，按配置脱敏或不记录
+	ClientIP         string    `gorm:"size:64" json:"client_ip"`              // 客户端IP
+	Status           string    `gorm:"size:16;not null;index" json:"status"`  // 请求结果：success、error、canceled
+	Error            string    `gorm:"type:text" json:"error"`                // 失败原因
+	PromptTokens     int       `json:"prompt_tokens"`                         // 提示词token数，多轮生成时累计
+	CompletionTokens int       `json:"completion_tokens"`                     // 生成token数，多轮生成时累计
+	ModelDurationMs  int64     `json:"model_duration_ms"`                     // 模型报告的总耗时
+	DurationMs       int64     `json:"duration_ms"`                           // 服务器处理请求的总耗时
+}
+
+// AuditLogFilter 审计日志查询条件，零值表示不限制
+type AuditLogFilter struct {
+	UserID uint
+	Model  string
+	Status string
+	From   time.Time // 包含
+	To     time.Time // 不包含
+}
+
+// CreateAuditLog 追加一条审计日志
+func CreateAuditLog(ctx context.Context, log *AuditLog) error {
+	return DB.WithContext(ctx).Create(log).Error
+}
+
+// QueryAuditLogs 按条件分页查询审计日志，列表不包含提示词和回复内容，同时返回总数
+func QueryAuditLogs(filter AuditLogFilter, offset, limit int) ([]AuditLog, int64, error) {
+	query := DB.Model(&AuditLog{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Model != "" {
+		query = query.Where("model_name = ?", filter.Model)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []AuditLog
+	result := query.Omit("prompt", "completion").Order("id desc").Offset(offset).Limit(limit).Find(&logs)
+	if result.Error != nil {
+		return nil, 0, result.Error
+	}
+	return logs, total, nil
+}
+
+// GetAuditLogByID 通过ID获取审计日志
+func GetAuditLogByID(id uint) (*AuditLog, error) {
+	var log AuditLog
+	result := DB.First(&log, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("审计日志不存在")
+		}
+		return nil, result.Error
+	}
+	return &log, nil
+}
+
+// PurgeAuditLogs 删除指定时间之前的审计日志，返回删除的条数
+func PurgeAuditLogs(before time.Time) (int64, error) {
+	result := DB.Where("created_at < ?", before).Delete(&AuditLog{})
+	return result.RowsAffected, result.Error
+}
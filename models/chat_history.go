@@ -7,14 +7,32 @@ import (
 	"gorm.io/gorm"
 )
 
+// 聊天历史记录的状态
+const (
+	HistoryStatusCompleted = "completed" // 最后一条回复正常生成完成
+	HistoryStatusError     = "error"     // 最后一条回复生成过程中出错，只保存了部分内容
+)
+
 // ChatHistory 聊天历史记录模型
 type ChatHistory struct {
 	gorm.Model
 	HistoryID string `gorm:"size:255;not null;unique" json:"history_id"` // 历史记录唯一标识
-	UserID    uint   `gorm:"not null" json:"user_id"`                   // 用户ID，外键关联到User表
-	ModelName     string `gorm:"size:255;not null" json:"model"`            // 使用的模型名称
+	UserID    uint   `gorm:"not null" json:"user_id"`                    // 用户ID，外键关联到User表
+	ModelName string `gorm:"size:255;not null" json:"model"`             // 使用的模型名称
 	Messages  string `gorm:"type:text;not null" json:"messages"`         // 聊天消息内容，JSON格式存储
-	User      User   `gorm:"foreignKey:UserID" json:"-"`                // 关联的用户
+	PresetID  *uint  `gorm:"index" json:"preset_id"`                     // 使用的提示词预设ID，可为空
+	User      User   `gorm:"foreignKey:UserID" json:"-"`                 // 关联的用户
+
+	Summary         string `gorm:"type:text" json:"summary"`                   // 较早消息的滚动摘要
+	SummarizedCount int    `gorm:"not null;default:0" json:"summarized_count"` // 摘要覆盖的前若干条消息数
+	SummaryDigest   string `gorm:"size:64" json:"-"`                           // 摘要覆盖消息的哈希，用于检测消息是否被修改
+
+	CompareGroupID  string `gorm:"size:255;index" json:"compare_group_id"`         // 对比模式的分组ID，同组记录共享，胜者成为普通聊天历史后清空
+	CompareParentID string `gorm:"size:255" json:"compare_parent_id"`              // 发起对比时所在的聊天历史ID，可为空
+	CompareRejected bool   `gorm:"not null;default:false" json:"compare_rejected"` // 选出胜者后未被选中的记录，不在聊天历史列表中显示
+
+	Status    string `gorm:"size:16;not null;default:completed" json:"status"` // 最后一条回复的状态：completed、error
+	ErrorCode string `gorm:"size:64" json:"error_code"`                        // 出错时的错误码，与error事件中的code一致
 }
 
 // SetMessages 将消息数组转换为JSON字符串并保存
@@ -59,7 +77,7 @@ func GetChatHistoryByID(id uint) (*ChatHistory, error) {
 // GetChatHistoriesByUserID 获取用户的所有聊天历史记录
 func GetChatHistoriesByUserID(userID uint) ([]ChatHistory, error) {
 	var histories []ChatHistory
-	result := DB.Where("user_id = ?", userID).Order("created_at desc").Find(&histories)
+	result := DB.Where("user_id = ? AND compare_rejected = ?", userID, false).Order("created_at desc").Find(&histories)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -79,8 +97,72 @@ func GetChatHistoryByHistoryID(historyID string) (*ChatHistory, error) {
 	return &history, nil
 }
 
+// UpdateChatHistorySummary 更新聊天历史的滚动摘要，只更新摘要相关字段，避免覆盖同时写入的消息
+func UpdateChatHistorySummary(id uint, summary string, count int, digest string) error {
+	result := DB.Model(&ChatHistory{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"summary":          summary,
+		"summarized_count": count,
+		"summary_digest":   digest,
+	})
+	return result.Error
+}
+
+// GetCompareGroup 获取用户某个对比分组中的所有聊天历史记录
+func GetCompareGroup(groupID string, userID uint) ([]ChatHistory, error) {
+	var histories []ChatHistory
+	result := DB.Where("compare_group_id = ? AND user_id = ?", groupID, userID).Order("id").Find(&histories)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return histories, nil
+}
+
+// PickCompareWinner 选出对比分组的胜者，返回继续对话的聊天历史记录
+// 从已有对话发起的对比，胜者的消息和状态写回原对话并删除胜者记录；否则胜者成为普通的聊天历史
+// 同组其他记录标记为未选中并保留，用于导出偏好数据
+func PickCompareWinner(winner *ChatHistory) (*ChatHistory, error) {
+	var thread *ChatHistory
+	groupID := winner.CompareGroupID
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		thread = winner
+		if winner.CompareParentID != "" {
+			var parent ChatHistory
+			result := tx.Where("history_id = ? AND user_id = ?", winner.CompareParentID, winner.UserID).First(&parent)
+			if result.Error == nil {
+				parent.Messages = winner.Messages
+				parent.ModelName = winner.ModelName
+				parent.PresetID = winner.PresetID
+				parent.Status = winner.Status
+				parent.ErrorCode = winner.ErrorCode
+				if err := tx.Model(&parent).Select("Messages", "ModelName", "PresetID", "Status", "ErrorCode").Updates(&parent).Error; err != nil {
+					return err
+				}
+				thread = &parent
+			} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return result.Error
+			}
+		}
+
+		// 原对话已被删除时胜者成为普通的聊天历史，否则胜者的消息已写回原对话
+		if thread == winner {
+			if err := tx.Model(winner).Updates(map[string]interface{}{"compare_group_id": "", "compare_parent_id": ""}).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Delete(winner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ChatHistory{}).
+			Where("compare_group_id = ? AND id <> ?", groupID, winner.ID).
+			Update("compare_rejected", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return thread, nil
+}
+
 // DeleteChatHistory 删除聊天历史记录
 func DeleteChatHistory(id uint) error {
 	result := DB.Delete(&ChatHistory{}, id)
 	return result.Error
-}
\ No newline at end of file
+}
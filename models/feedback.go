@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// 回复评价
+const (
+	RatingUp   = "up"   // 赞
+	RatingDown = "down" // 踩
+)
+
+// Feedback 用户对AI回复的评价
+type Feedback struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null;index" json:"user_id"`             // 评价者ID
+	HistoryID    string `gorm:"size:255;not null;index" json:"history_id"` // 聊天历史ID
+	MessageIndex int    `gorm:"not null" json:"message_index"`             // 被评价的消息在聊天历史中的下标
+	Rating       string `gorm:"size:8;not null" json:"rating"`             // 评价：up或down
+	Comment      string `gorm:"type:text" json:"comment"`                  // 评价说明，可为空
+	ModelName    string `gorm:"size:255;index" json:"model"`               // 生成回复的模型
+	PresetID     *uint  `gorm:"index" json:"preset_id"`                    // 生成回复时使用的提示词预设
+	Prompt       string `gorm:"type:text" json:"-"`                        // 被评价回复之前的消息，JSON格式存储
+	PromptDigest string `gorm:"size:64;index" json:"-"`                    // 提示词消息的哈希，用于匹配重新生成的回复
+	Response     string `gorm:"type:text" json:"response"`                 // 评价时的回复内容，重新生成后历史中的回复会被替换
+	User         User   `gorm:"foreignKey:UserID" json:"-"`                // 关联的用户
+}
+
+// FeedbackStat 按模型和预设汇总的评价统计
+type FeedbackStat struct {
+	ModelName string `json:"model"`
+	PresetID  *uint  `json:"preset_id"`
+	Total     int    `json:"total"`
+	Up        int    `json:"up"`
+	Down      int    `json:"down"`
+	Comments  int    `json:"comments"` // 带评价说明的数量
+}
+
+// ValidRating 判断评价是否有效
+func ValidRating(rating string) bool {
+	return rating == RatingUp || rating == RatingDown
+}
+
+// GetFeedbackByID 通过ID获取评价
+func GetFeedbackByID(id uint) (*Feedback, error) {
+	var feedback Feedback
+	result := DB.First(&feedback, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("评价不存在")
+		}
+		return nil, result.Error
+	}
+	return &feedback, nil
+}
+
+// FindFeedback 查找用户对同一条回复内容的评价，不存在时返回nil
+func FindFeedback(userID uint, historyID string, messageIndex int, response string) (*Feedback, error) {
+	var feedback Feedback
+	result := DB.Where("user_id = ? AND history_id = ? AND message_index = ? AND response = ?", userID, historyID, messageIndex, response).First(&feedback)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, result.Error
+	}
+	return &feedback, nil
+}
+
+// GetFeedbacksByUserID 获取用户的评价，historyID不为空时只返回该聊天历史的评价
+func GetFeedbacksByUserID(userID uint, historyID string) ([]Feedback, error) {
+	var feedbacks []Feedback
+	query := DB.Where("user_id = ?", userID)
+	if historyID != "" {
+		query = query.Where("history_id = ?", historyID)
+	}
+	result := query.Order("created_at desc").Find(&feedbacks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return feedbacks, nil
+}
+
+// GetFeedbackReport 按模型和预设汇总所有评价
+func GetFeedbackReport() ([]FeedbackStat, error) {
+	var stats []FeedbackStat
+	result := DB.Model(&Feedback{}).
+		Select("model_name, preset_id, COUNT(*) AS total, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS up, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS down, "+
+			"SUM(CASE WHEN comment <> '' THEN 1 ELSE 0 END) AS comments", RatingUp, RatingDown).
+		Group("model_name, preset_id").
+		Order("model_name, preset_id").
+		Scan(&stats)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return stats, nil
+}
+
+// GetPreferenceFeedbacks 获取同一条回复多次重新生成后既有赞又有踩的评价，用于导出偏好数据
+// 只在同一聊天历史、同一消息下标且提示词相同的评价之间配对，不同对话恰好提示词相同时不会混在一起
+// 结果按聊天历史、消息下标和提示词分组排序
+func GetPreferenceFeedbacks() ([]Feedback, error) {
+	var feedbacks []Feedback
+	pairs := DB.Model(&Feedback{}).
+		Select("history_id, message_index, prompt_digest").
+		Group("history_id, message_index, prompt_digest").
+		Having("SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) > 0 AND SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) > 0", RatingUp, RatingDown)
+	result := DB.Where("(history_id, message_index, prompt_digest) IN (?)", pairs).
+		Order("history_id, message_index, prompt_digest, id").
+		Find(&feedbacks)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return feedbacks, nil
+}
+
+// DeleteFeedback 删除评价
+func DeleteFeedback(id uint) error {
+	result := DB.Delete(&Feedback{}, id)
+	return result.Error
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 使用内存数据库替换全局数据库连接
+func setupTestDB(t *testing.T, models ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	previous := DB
+	DB = db
+	t.Cleanup(func() { DB = previous })
+}
+
+func TestGetPreferenceFeedbacks(t *testing.T) {
+	setupTestDB(t, &Feedback{})
+
+	feedbacks := []Feedback{
+		// 同一条回复重新生成前后的评价
+		{UserID: 1, HistoryID: "h1", MessageIndex: 1, PromptDigest: "hello", Rating: RatingDown, Response: "旧回复"},
+		{UserID: 1, HistoryID: "h1", MessageIndex: 1, PromptDigest: "hello", Rating: RatingUp, Response: "新回复"},
+		// 其他用户的对话恰好提示词相同，不能与h1配对
+		{UserID: 2, HistoryID: "h2", MessageIndex: 1, PromptDigest: "hello", Rating: RatingDown, Response: "别人的回复"},
+		// 同一对话中不同的消息
+		{UserID: 1, HistoryID: "h1", MessageIndex: 3, PromptDigest: "next", Rating: RatingDown, Response: "第二条回复"},
+	}
+	if err := DB.Create(&feedbacks).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetPreferenceFeedbacks()
+	if err != nil {
+		t.Fatalf("GetPreferenceFeedbacks() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("GetPreferenceFeedbacks() 返回%d条, 期望2条: %+v", len(got), got)
+	}
+	for _, feedback := range got {
+		if feedback.HistoryID != "h1" || feedback.MessageIndex != 1 {
+			t.Errorf("不应导出的评价: %+v", feedback)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// KnowledgeBase 知识库模型
+type KnowledgeBase struct {
+	gorm.Model
+	Name           string `gorm:"size:255;not null" json:"name"`            // 知识库名称
+	Description    string `gorm:"type:text" json:"description"`             // 知识库说明
+	EmbeddingModel string `gorm:"size:255;not null" json:"embedding_model"` // 向量模型，创建后不可修改
+	UserID         uint   `gorm:"not null;index" json:"user_id"`            // 创建者ID
+	Shared         bool   `gorm:"not null;default:false" json:"shared"`     // 是否共享给所有用户
+	User           User   `gorm:"foreignKey:UserID" json:"-"`               // 关联的用户
+}
+
+// Document 知识库中的文档
+type Document struct {
+	gorm.Model
+	KnowledgeBaseID uint   `gorm:"not null;index" json:"knowledge_base_id"` // 所属知识库ID
+	Filename        string `gorm:"size:255;not null" json:"filename"`       // 原始文件名
+	Size            int64  `gorm:"not null" json:"size"`                    // 文件字节数
+	ChunkCount      int    `gorm:"not null" json:"chunk_count"`             // 分块数量
+	UserID          uint   `gorm:"not null;index" json:"user_id"`           // 上传者ID
+}
+
+// DocumentChunk 文档分块及其向量
+type DocumentChunk struct {
+	ID              uint   `gorm:"primarykey"`
+	KnowledgeBaseID uint   `gorm:"not null;index"`
+	DocumentID      uint   `gorm:"not null;index"`
+	ChunkIndex      int    `gorm:"not null"`           // 分块在文档中的序号
+	Content         string `gorm:"type:text;not null"` // 分块文本
+	Embedding       []byte `gorm:"type:blob;not null"` // 向量，float32小端序
+}
+
+// ChunkMatch 向量检索结果
+type ChunkMatch struct {
+	Chunk    DocumentChunk
+	Filename string
+	Score    float64 // 余弦相似度
+}
+
+// CanAccess 判断用户是否可以使用该知识库
+func (kb *KnowledgeBase) CanAccess(userID uint) bool {
+	return kb.Shared || kb.UserID == userID
+}
+
+// EncodeVector 将向量编码为BLOB
+func EncodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// DecodeVector 将BLOB解码为向量
+func DecodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
+
+// cosineSimilarity 计算两个向量的余弦相似度，维度不同或为零向量时返回0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// SearchChunks 在指定知识库中暴力检索与query最相似的topK个分块
+func SearchChunks(knowledgeBaseIDs []uint, query []float32, topK int, minScore float64) ([]ChunkMatch, error) {
+	var matches []ChunkMatch
+	var batch []DocumentChunk
+	result := DB.Where("knowledge_base_id IN ?", knowledgeBaseIDs).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, chunk := range batch {
+			score := cosineSimilarity(query, DecodeVector(chunk.Embedding))
+			if score < minScore {
+				continue
+			}
+			matches = append(matches, ChunkMatch{Chunk: chunk, Score: score})
+		}
+		// 只保留当前最相似的topK个，避免占用过多内存
+		sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+		if len(matches) > topK {
+			matches = matches[:topK]
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// 一次查询补全文档名称
+	if len(matches) == 0 {
+		return matches, nil
+	}
+	documentIDs := make([]uint, 0, len(matches))
+	for _, match := range matches {
+		documentIDs = append(documentIDs, match.Chunk.DocumentID)
+	}
+	var documents []Document
+	if err := DB.Select("id", "filename").Where("id IN ?", documentIDs).Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	filenames := make(map[uint]string, len(documents))
+	for _, document := range documents {
+		filenames[document.ID] = document.Filename
+	}
+	for i := range matches {
+		matches[i].Filename = filenames[matches[i].Chunk.DocumentID]
+	}
+	return matches, nil
+}
+
+// CreateDocumentWithChunks 在同一事务中保存文档和分块
+func CreateDocumentWithChunks(document *Document, chunks []DocumentChunk) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(document).Error; err != nil {
+			return err
+		}
+		for i := range chunks {
+			chunks[i].KnowledgeBaseID = document.KnowledgeBaseID
+			chunks[i].DocumentID = document.ID
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(chunks, 100).Error
+	})
+}
+
+// GetKnowledgeBaseByID 通过ID获取知识库
+func GetKnowledgeBaseByID(id uint) (*KnowledgeBase, error) {
+	var kb KnowledgeBase
+	result := DB.First(&kb, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("知识库不存在")
+		}
+		return nil, result.Error
+	}
+	return &kb, nil
+}
+
+// GetAccessibleKnowledgeBases 获取用户自己的和共享的知识库
+func GetAccessibleKnowledgeBases(userID uint) ([]KnowledgeBase, error) {
+	var kbs []KnowledgeBase
+	result := DB.Where("user_id = ? OR shared = ?", userID, true).Order("created_at desc").Find(&kbs)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return kbs, nil
+}
+
+// GetDocumentsByKnowledgeBaseID 获取知识库中的所有文档
+func GetDocumentsByKnowledgeBaseID(knowledgeBaseID uint) ([]Document, error) {
+	var documents []Document
+	result := DB.Where("knowledge_base_id = ?", knowledgeBaseID).Order("created_at desc").Find(&documents)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return documents, nil
+}
+
+// GetDocumentByID 通过ID获取文档
+func GetDocumentByID(id uint) (*Document, error) {
+	var document Document
+	result := DB.First(&document, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("文档不存在")
+		}
+		return nil, result.Error
+	}
+	return &document, nil
+}
+
+// DeleteDocument 删除文档及其分块
+func DeleteDocument(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", id).Delete(&DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Document{}, id).Error
+	})
+}
+
+// DeleteKnowledgeBase 删除知识库及其文档和分块
+func DeleteKnowledgeBase(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("knowledge_base_id = ?", id).Delete(&DocumentChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("knowledge_base_id = ?", id).Delete(&Document{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&KnowledgeBase{}, id).Error
+	})
+}
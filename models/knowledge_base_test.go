@@ -0,0 +1,42 @@
+package models
+
+import "testing"
+
+func TestSearchChunks(t *testing.T) {
+	setupTestDB(t, &Document{}, &DocumentChunk{})
+
+	for i, filename := range []string{"a.md", "b.md"} {
+		document := Document{KnowledgeBaseID: 1, Filename: filename, UserID: 1}
+		chunks := []DocumentChunk{
+			{KnowledgeBaseID: 1, ChunkIndex: 0, Content: filename + "-0", Embedding: EncodeVector([]float32{1, float32(i)})},
+			{KnowledgeBaseID: 1, ChunkIndex: 1, Content: filename + "-1", Embedding: EncodeVector([]float32{0, 1})},
+		}
+		if err := CreateDocumentWithChunks(&document, chunks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 其他知识库的分块不参与检索
+	other := Document{KnowledgeBaseID: 2, Filename: "other.md", UserID: 1}
+	if err := CreateDocumentWithChunks(&other, []DocumentChunk{{KnowledgeBaseID: 2, Content: "other", Embedding: EncodeVector([]float32{1, 0})}}); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := SearchChunks([]uint{1}, []float32{1, 0}, 2, 0.1)
+	if err != nil {
+		t.Fatalf("SearchChunks() error = %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("SearchChunks() 返回%d个分块, 期望2个", len(matches))
+	}
+	want := []struct{ content, filename string }{{"a.md-0", "a.md"}, {"b.md-0", "b.md"}}
+	for i, match := range matches {
+		if match.Chunk.Content != want[i].content || match.Filename != want[i].filename {
+			t.Errorf("第%d个结果 = %s (%s), 期望 %s (%s)", i, match.Chunk.Content, match.Filename, want[i].content, want[i].filename)
+		}
+	}
+
+	matches, err = SearchChunks([]uint{1}, []float32{-1, -1}, 4, 0.1)
+	if err != nil || len(matches) != 0 {
+		t.Errorf("没有满足最低相似度的分块时应返回空结果, got %v, %v", matches, err)
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// PromptPreset 提示词预设模型
+type PromptPreset struct {
+	gorm.Model
+	Name         string `gorm:"size:255;not null" json:"name"`        // 预设名称
+	SystemPrompt string `gorm:"type:text" json:"system_prompt"`       // 系统提示词
+	DefaultModel string `gorm:"size:255" json:"default_model"`        // 默认模型，请求未指定模型时使用
+	Options      string `gorm:"type:text" json:"-"`                   // 默认模型参数，JSON格式存储
+	UserID       uint   `gorm:"not null;index" json:"user_id"`        // 创建者ID
+	Shared       bool   `gorm:"not null;default:false" json:"shared"` // 是否共享给所有用户
+	User         User   `gorm:"foreignKey:UserID" json:"-"`           // 关联的用户
+}
+
+// SetOptions 将模型参数转换为JSON字符串并保存
+func (p *PromptPreset) SetOptions(options map[string]interface{}) error {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	p.Options = string(optionsJSON)
+	return nil
+}
+
+// GetOptions 将JSON字符串转换为模型参数
+func (p *PromptPreset) GetOptions() (map[string]interface{}, error) {
+	options := make(map[string]interface{})
+	if p.Options == "" {
+		return options, nil
+	}
+	err := json.Unmarshal([]byte(p.Options), &options)
+	return options, err
+}
+
+// CanAccess 判断用户是否可以使用该预设
+func (p *PromptPreset) CanAccess(userID uint) bool {
+	return p.Shared || p.UserID == userID
+}
+
+// GetPromptPresetByID 通过ID获取提示词预设
+func GetPromptPresetByID(id uint) (*PromptPreset, error) {
+	var preset PromptPreset
+	result := DB.First(&preset, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("提示词预设不存在")
+		}
+		return nil, result.Error
+	}
+	return &preset, nil
+}
+
+// GetAccessiblePromptPresets 获取用户自己的和共享的提示词预设
+func GetAccessiblePromptPresets(userID uint) ([]PromptPreset, error) {
+	var presets []PromptPreset
+	result := DB.Where("user_id = ? OR shared = ?", userID, true).Order("created_at desc").Find(&presets)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return presets, nil
+}
+
+// DeletePromptPreset 删除提示词预设
+func DeletePromptPreset(id uint) error {
+	result := DB.Delete(&PromptPreset{}, id)
+	return result.Error
+}
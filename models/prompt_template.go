@@ -0,0 +1,374 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// 模板变量类型
+const (
+	VariableTypeString  = "string"
+	VariableTypeNumber  = "number"
+	VariableTypeBoolean = "boolean"
+	VariableTypeEnum    = "enum"
+)
+
+// maxRenderedLength 渲染结果的最大字节数
+const maxRenderedLength = 256 * 1024
+
+// variableNamePattern 变量名必须是合法的标识符，才能在模板中以{{name}}或{{.name}}引用
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TemplateVariable 模板变量定义
+type TemplateVariable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`                  // string、number、boolean、enum
+	Required    bool        `json:"required"`              // 是否必填
+	Default     interface{} `json:"default,omitempty"`     // 未填写时的默认值
+	Enum        []string    `json:"enum,omitempty"`        // enum类型的可选值
+	MaxLength   int         `json:"max_length,omitempty"`  // string类型的最大字符数，0表示不限制
+	Description string      `json:"description,omitempty"` // 变量说明
+}
+
+// PromptTemplate 提示词模板模型
+type PromptTemplate struct {
+	gorm.Model
+	Name        string `gorm:"size:255;not null" json:"name"`        // 模板名称
+	Description string `gorm:"type:text" json:"description"`         // 模板说明
+	Content     string `gorm:"type:text;not null" json:"content"`    // 模板内容，使用text/template语法
+	Variables   string `gorm:"type:text" json:"-"`                   // 变量定义，JSON格式存储
+	UserID      uint   `gorm:"not null;index" json:"user_id"`        // 创建者ID
+	Shared      bool   `gorm:"not null;default:false" json:"shared"` // 是否共享给所有用户
+	User        User   `gorm:"foreignKey:UserID" json:"-"`           // 关联的用户
+}
+
+// SetVariables 将变量定义转换为JSON字符串并保存
+func (t *PromptTemplate) SetVariables(variables []TemplateVariable) error {
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return err
+	}
+	t.Variables = string(variablesJSON)
+	return nil
+}
+
+// GetVariables 将JSON字符串转换为变量定义
+func (t *PromptTemplate) GetVariables() ([]TemplateVariable, error) {
+	variables := []TemplateVariable{}
+	if t.Variables == "" {
+		return variables, nil
+	}
+	err := json.Unmarshal([]byte(t.Variables), &variables)
+	return variables, err
+}
+
+// CanAccess 判断用户是否可以使用该模板
+func (t *PromptTemplate) CanAccess(userID uint) bool {
+	return t.Shared || t.UserID == userID
+}
+
+// reservedNames text/template的内置函数和关键字，不能作为变量名
+var reservedNames = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true,
+	"len": true, "not": true, "or": true, "print": true, "printf": true, "println": true,
+	"urlquery": true, "eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+	"true": true, "false": true, "nil": true,
+}
+
+// templateFuncs 模板中可以使用的安全函数
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"default": func(def, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+	"truncate": func(n int, s string) (string, error) {
+		if n < 0 {
+			return "", fmt.Errorf("truncate的长度不能为负数: %d", n)
+		}
+		if utf8.RuneCountInString(s) <= n {
+			return s, nil
+		}
+		return string([]rune(s)[:n]), nil
+	},
+	"indent": func(n int, s string) (string, error) {
+		if n < 0 {
+			return "", fmt.Errorf("indent的缩进不能为负数: %d", n)
+		}
+		// 在分配内存之前检查结果长度，每一行都会加上缩进，过大的n会直接耗尽内存
+		lines := strings.Count(s, "\n") + 1
+		if n > maxRenderedLength || n*lines+len(s) > maxRenderedLength {
+			return "", errors.New("渲染结果过长")
+		}
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad), nil
+	},
+	"quote": func(s string) string {
+		return fmt.Sprintf("%q", s)
+	},
+	"printf": safePrintf,
+}
+
+// printfWidthPattern 匹配格式化动词中的宽度和精度
+var printfWidthPattern = regexp.MustCompile(`%[-+# 0]*(\*|\d+)?(?:\.(\*|\d+))?`)
+
+// safePrintf 替换内置的printf，限制宽度和精度，避免{{printf "%999999999d" 1}}一次分配大量内存
+func safePrintf(format string, args ...interface{}) (string, error) {
+	for _, match := range printfWidthPattern.FindAllStringSubmatch(format, -1) {
+		for _, size := range match[1:] {
+			if size == "*" {
+				return "", errors.New("printf不支持*宽度")
+			}
+			if len(size) > 6 {
+				return "", errors.New("渲染结果过长")
+			}
+			if n, _ := strconv.Atoi(size); n > maxRenderedLength {
+				return "", errors.New("渲染结果过长")
+			}
+		}
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+// parseTemplate 解析模板内容，变量同时注册为同名函数，以支持{{language}}这种写法
+func parseTemplate(content string, values map[string]interface{}) (*template.Template, error) {
+	funcs := template.FuncMap{}
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	for name, value := range values {
+		value := value
+		funcs[name] = func() interface{} { return value }
+	}
+
+	tmpl, err := template.New("prompt").Option("missingkey=error").Funcs(funcs).Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("模板语法错误: %v", err)
+	}
+	if err := checkTemplateNodes(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// checkTemplateNodes 禁止使用range、template等可能导致大量输出或引用其他模板的语法
+func checkTemplateNodes(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNodes(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		if err := checkTemplateNodes(n.List); err != nil {
+			return err
+		}
+		return checkTemplateNodes(n.ElseList)
+	case *parse.WithNode:
+		if err := checkTemplateNodes(n.List); err != nil {
+			return err
+		}
+		return checkTemplateNodes(n.ElseList)
+	case *parse.TextNode, *parse.ActionNode, *parse.CommentNode:
+		return nil
+	default:
+		return fmt.Errorf("模板中不允许使用该语法: %s", node.String())
+	}
+	return nil
+}
+
+// ValidateDefinition 校验模板内容和变量定义
+func (t *PromptTemplate) ValidateDefinition() error {
+	variables, err := t.GetVariables()
+	if err != nil {
+		return errors.New("变量定义格式错误")
+	}
+
+	values := make(map[string]interface{}, len(variables))
+	for _, v := range variables {
+		if !variableNamePattern.MatchString(v.Name) {
+			return fmt.Errorf("变量名不合法: %s", v.Name)
+		}
+		if _, ok := templateFuncs[v.Name]; ok || reservedNames[v.Name] {
+			return fmt.Errorf("变量名与模板函数重名: %s", v.Name)
+		}
+		if _, ok := values[v.Name]; ok {
+			return fmt.Errorf("变量名重复: %s", v.Name)
+		}
+		switch v.Type {
+		case VariableTypeString, VariableTypeNumber, VariableTypeBoolean:
+		case VariableTypeEnum:
+			if len(v.Enum) == 0 {
+				return fmt.Errorf("enum类型的变量%s必须设置可选值", v.Name)
+			}
+		default:
+			return fmt.Errorf("变量%s的类型不受支持: %s", v.Name, v.Type)
+		}
+		if v.Default != nil {
+			if _, err := v.convert(v.Default); err != nil {
+				return fmt.Errorf("变量%s的默认值无效: %v", v.Name, err)
+			}
+		}
+		values[v.Name] = nil
+	}
+
+	_, err = parseTemplate(t.Content, values)
+	return err
+}
+
+// convert 按变量类型校验并转换变量值
+func (v TemplateVariable) convert(value interface{}) (interface{}, error) {
+	switch v.Type {
+	case VariableTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("应为字符串")
+		}
+		if v.MaxLength > 0 && utf8.RuneCountInString(s) > v.MaxLength {
+			return nil, fmt.Errorf("长度不能超过%d", v.MaxLength)
+		}
+		return s, nil
+	case VariableTypeNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+		return nil, errors.New("应为数字")
+	case VariableTypeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("应为布尔值")
+		}
+		return b, nil
+	case VariableTypeEnum:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("应为字符串")
+		}
+		for _, option := range v.Enum {
+			if option == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("只能是%s之一", strings.Join(v.Enum, "、"))
+	}
+	return nil, fmt.Errorf("类型不受支持: %s", v.Type)
+}
+
+// zeroValue 返回变量类型的零值
+func (v TemplateVariable) zeroValue() interface{} {
+	switch v.Type {
+	case VariableTypeNumber:
+		return float64(0)
+	case VariableTypeBoolean:
+		return false
+	}
+	return ""
+}
+
+// Render 校验变量并渲染模板
+func (t *PromptTemplate) Render(input map[string]interface{}) (string, error) {
+	variables, err := t.GetVariables()
+	if err != nil {
+		return "", errors.New("变量定义格式错误")
+	}
+
+	// 校验变量值，未填写的变量使用默认值
+	values := make(map[string]interface{}, len(variables))
+	for _, v := range variables {
+		raw, ok := input[v.Name]
+		if !ok || raw == nil {
+			switch {
+			case v.Default != nil:
+				raw = v.Default
+			case v.Required:
+				return "", fmt.Errorf("缺少必填变量: %s", v.Name)
+			default:
+				values[v.Name] = v.zeroValue()
+				continue
+			}
+		}
+		value, err := v.convert(raw)
+		if err != nil {
+			return "", fmt.Errorf("变量%s%v", v.Name, err)
+		}
+		values[v.Name] = value
+	}
+	for name := range input {
+		if _, ok := values[name]; !ok {
+			return "", fmt.Errorf("未定义的变量: %s", name)
+		}
+	}
+
+	tmpl, err := parseTemplate(t.Content, values)
+	if err != nil {
+		return "", err
+	}
+
+	var buf limitedBuffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("渲染模板失败: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// limitedBuffer 限制渲染结果长度的缓冲区
+type limitedBuffer struct {
+	strings.Builder
+}
+
+// Write 超过最大长度时返回错误
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > maxRenderedLength {
+		return 0, errors.New("渲染结果过长")
+	}
+	return b.Builder.Write(p)
+}
+
+// GetPromptTemplateByID 通过ID获取提示词模板
+func GetPromptTemplateByID(id uint) (*PromptTemplate, error) {
+	var tmpl PromptTemplate
+	result := DB.First(&tmpl, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("提示词模板不存在")
+		}
+		return nil, result.Error
+	}
+	return &tmpl, nil
+}
+
+// GetAccessiblePromptTemplates 获取用户自己的和共享的提示词模板
+func GetAccessiblePromptTemplates(userID uint) ([]PromptTemplate, error) {
+	var templates []PromptTemplate
+	result := DB.Where("user_id = ? OR shared = ?", userID, true).Order("created_at desc").Find(&templates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return templates, nil
+}
+
+// DeletePromptTemplate 删除提示词模板
+func DeletePromptTemplate(id uint) error {
+	result := DB.Delete(&PromptTemplate{}, id)
+	return result.Error
+}
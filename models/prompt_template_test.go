@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderRejectsHostileTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"超大缩进", `{{indent 2000000000 "a"}}`},
+		{"缩进乘以行数超过上限", `{{indent 1000 "` + strings.Repeat(`a\n`, 300) + `"}}`},
+		{"嵌套缩进", `{{indent 100000 (indent 100000 (indent 100000 "a"))}}`},
+		{"负数缩进", `{{indent -1 "a"}}`},
+		{"负数截断长度", `{{truncate -1 "abc"}}`},
+		{"printf超大宽度", `{{printf "%2000000000d" 1}}`},
+		{"printf超大精度", `{{printf "%.999999999f" 1.0}}`},
+		{"printf星号宽度", `{{printf "%*d" 2000000000 1}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &PromptTemplate{Content: tt.content}
+			if _, err := tmpl.Render(nil); err == nil {
+				t.Errorf("Render(%q) 应返回错误", tt.content)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"缩进每一行", `{{indent 2 "a\nb"}}`, "  a\n  b"},
+		{"截断", `{{truncate 2 "你好世界"}}`, "你好"},
+		{"截断长度为0", `{{truncate 0 "abc"}}`, ""},
+		{"printf", `{{printf "%05.1f|%-3s|%%" 3.14159 "x"}}`, "003.1|x  |%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := &PromptTemplate{Content: tt.content}
+			got, err := tmpl.Render(nil)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
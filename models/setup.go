@@ -1,8 +1,11 @@
 package models
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/glebarez/sqlite" // 替换为纯Go实现的SQLite驱动
 	"gorm.io/gorm"
@@ -12,36 +15,87 @@ import (
 // 全局数据库连接
 var DB *gorm.DB
 
-// ConnectDatabase 初始化数据库连接
-func ConnectDatabase() {
-	// 获取数据库路径，默认为data.db
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "data.db"
-	}
+// slogWriter 把GORM的日志转发到当前的slog默认Logger，配置热加载后使用新的日志格式
+type slogWriter struct{}
+
+// Printf 实现logger.Writer接口
+func (slogWriter) Printf(format string, args ...interface{}) {
+	slog.Warn(fmt.Sprintf(format, args...), "component", "gorm")
+}
 
-	// 设置日志级别
-	logLevel := logger.Info
-	if os.Getenv("GIN_MODE") == "release" {
+// ConnectDatabase 初始化数据库连接，release为true时只记录错误日志
+func ConnectDatabase(dbPath string, release bool) {
+	// 设置日志级别，不输出每条SQL，避免绕过日志的内容脱敏记录聊天内容
+	logLevel := logger.Warn
+	if release {
 		logLevel = logger.Error
 	}
 
-	// 连接数据库
+	// 连接数据库，GORM的日志通过slog输出，慢查询和错误日志中不带参数值
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: logger.New(slogWriter{}, logger.Config{
+			SlowThreshold:             time.Millisecond * 200,
+			LogLevel:                  logLevel,
+			IgnoreRecordNotFoundError: true,
+			ParameterizedQueries:      true,
+		}),
 	})
 
 	if err != nil {
-		log.Fatalf("无法连接到数据库: %v", err)
+		slog.Error("无法连接到数据库", "error", err)
+		os.Exit(1)
+	}
+
+	// 统计数据库查询耗时
+	if err := registerMetricsCallbacks(db); err != nil {
+		slog.Error("注册数据库监控回调失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 为带有链路上下文的查询创建span
+	if err := registerTracingCallbacks(db); err != nil {
+		slog.Error("注册数据库链路追踪回调失败", "error", err)
+		os.Exit(1)
 	}
 
 	DB = db
 
 	// 自动迁移数据库表结构
-	err = DB.AutoMigrate(&User{}, &ChatHistory{})
+	err = DB.AutoMigrate(&User{}, &ChatHistory{}, &PromptPreset{}, &PromptTemplate{}, &KnowledgeBase{}, &Document{}, &DocumentChunk{}, &Attachment{}, &Feedback{}, &AuditLog{})
 	if err != nil {
-		log.Fatalf("自动迁移失败: %v", err)
+		slog.Error("自动迁移失败", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("数据库连接成功")
-}
\ No newline at end of file
+	slog.Info("数据库连接成功", "path", dbPath)
+}
+
+// Ping 检查数据库连接是否可用
+func Ping(ctx context.Context) error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// DatabaseSize 返回SQLite数据库文件的大小，单位字节
+func DatabaseSize() (int64, error) {
+	var pageCount, pageSize int64
+	if err := DB.Raw("PRAGMA page_count").Scan(&pageCount).Error; err != nil {
+		return 0, err
+	}
+	if err := DB.Raw("PRAGMA page_size").Scan(&pageSize).Error; err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// CloseDatabase 关闭数据库连接
+func CloseDatabase() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
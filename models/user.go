@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"html"
 	"strings"
@@ -12,9 +13,10 @@ import (
 // User 用户模型
 type User struct {
 	gorm.Model
-	Username string `gorm:"size:255;not null;unique" json:"username"`
-	Password string `gorm:"size:255;not null" json:"-"`
-	Email    string `gorm:"size:255;not null;unique" json:"email"`
+	Username    string `gorm:"size:255;not null;unique" json:"username"`
+	Password    string `gorm:"size:255;not null" json:"-"`
+	Email       string `gorm:"size:255;not null;unique" json:"email"`
+	Preferences string `gorm:"type:text" json:"-"` // 用户偏好的模型参数，JSON格式存储
 }
 
 // HashPassword 对密码进行哈希处理
@@ -32,6 +34,26 @@ func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
 
+// SetPreferences 将模型参数偏好转换为JSON字符串并保存
+func (u *User) SetPreferences(options map[string]interface{}) error {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	u.Preferences = string(optionsJSON)
+	return nil
+}
+
+// GetPreferences 将JSON字符串转换为模型参数偏好
+func (u *User) GetPreferences() (map[string]interface{}, error) {
+	options := make(map[string]interface{})
+	if u.Preferences == "" {
+		return options, nil
+	}
+	err := json.Unmarshal([]byte(u.Preferences), &options)
+	return options, err
+}
+
 // BeforeSave 保存前的处理
 func (u *User) BeforeSave(tx *gorm.DB) error {
 	// 清理用户名和邮箱
@@ -53,6 +75,19 @@ func FindUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// FindUserByID 通过ID查找用户
+func FindUserByID(id uint) (*User, error) {
+	var user User
+	result := DB.First(&user, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
 // FindUserByEmail 通过邮箱查找用户
 func FindUserByEmail(email string) (*User, error) {
 	var user User
@@ -64,4 +99,4 @@ func FindUserByEmail(email string) (*User, error) {
 		return nil, result.Error
 	}
 	return &user, nil
-}
\ No newline at end of file
+}
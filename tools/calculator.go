@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"strconv"
+)
+
+// maxExpressionLength 表达式的最大长度
+const maxExpressionLength = 500
+
+// Calculator 计算数学表达式
+type Calculator struct{}
+
+// Name 工具名称
+func (Calculator) Name() string { return "calculator" }
+
+// Description 工具说明
+func (Calculator) Description() string {
+	return "计算数学表达式，支持+、-、*、/、%、括号以及sqrt、pow、abs、floor、ceil、round、log、exp、sin、cos、tan等函数"
+}
+
+// Parameters 参数定义
+func (Calculator) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"expression": map[string]interface{}{
+				"type":        "string",
+				"description": "要计算的表达式，例如 (1+2)*sqrt(16)",
+			},
+		},
+		"required": []string{"expression"},
+	}
+}
+
+// Call 解析并计算表达式
+func (Calculator) Call(_ Context, args map[string]interface{}) (string, error) {
+	expression, err := stringArg(args, "expression", true)
+	if err != nil {
+		return "", err
+	}
+	if len(expression) > maxExpressionLength {
+		return "", errors.New("表达式过长")
+	}
+
+	// 使用Go的表达式语法解析，只允许数字、运算符和白名单中的函数
+	expr, err := parser.ParseExpr(expression)
+	if err != nil {
+		return "", fmt.Errorf("表达式语法错误: %v", err)
+	}
+	result, err := evaluate(expr)
+	if err != nil {
+		return "", err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return "", errors.New("计算结果不是有限数字")
+	}
+	return strconv.FormatFloat(result, 'g', -1, 64), nil
+}
+
+// mathFuncs 表达式中可以使用的函数
+var mathFuncs = map[string]func(args []float64) (float64, error){
+	"sqrt":  unary(math.Sqrt),
+	"abs":   unary(math.Abs),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"log":   unary(math.Log),
+	"log10": unary(math.Log10),
+	"exp":   unary(math.Exp),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"pow": func(args []float64) (float64, error) {
+		if len(args) != 2 {
+			return 0, errors.New("pow需要2个参数")
+		}
+		return math.Pow(args[0], args[1]), nil
+	},
+}
+
+// mathConsts 表达式中可以使用的常量
+var mathConsts = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// unary 将单参数函数包装为通用函数
+func unary(fn func(float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, errors.New("函数需要1个参数")
+		}
+		return fn(args[0]), nil
+	}
+}
+
+// evaluate 递归计算表达式
+func evaluate(expr ast.Expr) (float64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return 0, fmt.Errorf("不支持的字面量: %s", e.Value)
+		}
+		return strconv.ParseFloat(e.Value, 64)
+	case *ast.Ident:
+		if value, ok := mathConsts[e.Name]; ok {
+			return value, nil
+		}
+		return 0, fmt.Errorf("未知的标识符: %s", e.Name)
+	case *ast.ParenExpr:
+		return evaluate(e.X)
+	case *ast.UnaryExpr:
+		x, err := evaluate(e.X)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.SUB:
+			return -x, nil
+		case token.ADD:
+			return x, nil
+		}
+		return 0, fmt.Errorf("不支持的运算符: %s", e.Op)
+	case *ast.BinaryExpr:
+		x, err := evaluate(e.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evaluate(e.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return 0, errors.New("除数不能为0")
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return 0, errors.New("除数不能为0")
+			}
+			return math.Mod(x, y), nil
+		}
+		return 0, fmt.Errorf("不支持的运算符: %s", e.Op)
+	case *ast.CallExpr:
+		ident, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			return 0, errors.New("不支持的函数调用")
+		}
+		fn, ok := mathFuncs[ident.Name]
+		if !ok {
+			return 0, fmt.Errorf("未知的函数: %s", ident.Name)
+		}
+		args := make([]float64, 0, len(e.Args))
+		for _, arg := range e.Args {
+			value, err := evaluate(arg)
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, value)
+		}
+		return fn(args)
+	}
+	return 0, errors.New("不支持的表达式")
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/trae-ds-go-backend/config"
+	"github.com/trae-ds-go-backend/models"
+)
+
+// 历史记录搜索的结果数量和片段长度
+const (
+	historySearchLimit = 5
+	historySnippetSize = 200
+)
+
+// HistorySearch 搜索当前用户的聊天历史
+type HistorySearch struct{}
+
+// Name 工具名称
+func (HistorySearch) Name() string { return "history_search" }
+
+// Description 工具说明
+func (HistorySearch) Description() string {
+	return "在当前用户之前的聊天记录中搜索包含关键词的消息，用于回忆之前讨论过的内容"
+}
+
+// Parameters 参数定义
+func (HistorySearch) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "要搜索的关键词",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+// historyMatch 历史记录搜索结果
+type historyMatch struct {
+	HistoryID string `json:"history_id"`
+	Role      string `json:"role"`
+	Snippet   string `json:"snippet"`
+}
+
+// likeEscaper 转义LIKE中的通配符，使查询中的%和_按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Call 搜索用户的聊天历史，返回JSON格式的匹配片段
+func (HistorySearch) Call(ctx Context, args map[string]interface{}) (string, error) {
+	query, err := stringArg(args, "query", true)
+	if err != nil {
+		return "", err
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return "[]", nil
+	}
+
+	// 先用LIKE缩小范围，再在消息中定位匹配片段
+	var histories []models.ChatHistory
+	result := models.DB.Where(`user_id = ? AND messages LIKE ? ESCAPE '\'`, ctx.UserID, "%"+likeEscaper.Replace(query)+"%").
+		Order("updated_at desc").Limit(20).Find(&histories)
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	matches := []historyMatch{}
+	for _, history := range histories {
+		var messages []config.Message
+		if err := json.Unmarshal([]byte(history.Messages), &messages); err != nil {
+			continue
+		}
+		for _, message := range messages {
+			if message.Role != "user" && message.Role != "assistant" {
+				continue
+			}
+			if snippet, ok := snippetAround(message.Content, query); ok {
+				matches = append(matches, historyMatch{HistoryID: history.HistoryID, Role: message.Role, Snippet: snippet})
+				if len(matches) >= historySearchLimit {
+					break
+				}
+			}
+		}
+		if len(matches) >= historySearchLimit {
+			break
+		}
+	}
+
+	data, err := json.Marshal(matches)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// snippetAround 截取关键词附近的内容
+func snippetAround(content, query string) (string, bool) {
+	idx := strings.Index(strings.ToLower(content), strings.ToLower(query))
+	if idx < 0 {
+		return "", false
+	}
+	runes := []rune(content)
+	center := utf8.RuneCountInString(content[:idx])
+	start := center - historySnippetSize/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + historySnippetSize
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[start:end]), true
+}
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"fmt"
+	"time"
+)
+
+// CurrentTime 获取当前时间
+type CurrentTime struct{}
+
+// Name 工具名称
+func (CurrentTime) Name() string { return "current_time" }
+
+// Description 工具说明
+func (CurrentTime) Description() string {
+	return "获取当前的日期和时间，可以指定IANA时区，例如Asia/Shanghai"
+}
+
+// Parameters 参数定义
+func (CurrentTime) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "IANA时区名称，为空时使用服务器时区",
+			},
+		},
+	}
+}
+
+// Call 返回指定时区的当前时间
+func (CurrentTime) Call(_ Context, args map[string]interface{}) (string, error) {
+	timezone, err := stringArg(args, "timezone", false)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return "", fmt.Errorf("未知的时区: %s", timezone)
+		}
+		now = now.In(location)
+	}
+	return fmt.Sprintf("%s（%s）", now.Format(time.RFC3339), now.Weekday()), nil
+}
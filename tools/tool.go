@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/trae-ds-go-backend/config"
+)
+
+// Context 工具调用的上下文
+type Context struct {
+	UserID uint // 发起聊天的用户ID
+}
+
+// Tool 可供模型调用的服务器端工具
+type Tool interface {
+	Name() string                       // 工具名称，模型通过该名称调用
+	Description() string                // 工具说明，帮助模型判断何时调用
+	Parameters() map[string]interface{} // JSON Schema格式的参数定义
+	Call(ctx Context, args map[string]interface{}) (string, error)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = make(map[string]Tool)
+)
+
+// Register 注册工具，名称重复时覆盖之前的工具
+func Register(tool Tool) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[tool.Name()] = tool
+}
+
+// Get 按名称获取工具
+func Get(name string) (Tool, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	tool, ok := registry[name]
+	return tool, ok
+}
+
+// Names 返回所有已注册工具的名称
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definition 构建发送给模型的工具定义
+func Definition(tool Tool) config.ToolDefinition {
+	return config.ToolDefinition{
+		Type: "function",
+		Function: config.ToolFunction{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		},
+	}
+}
+
+// Execute 执行一次工具调用，工具不存在或参数错误时返回错误
+func Execute(ctx Context, call config.ToolCall) (string, error) {
+	tool, ok := Get(call.Function.Name)
+	if !ok {
+		return "", fmt.Errorf("未知的工具: %s", call.Function.Name)
+	}
+	args := call.Function.Arguments
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return tool.Call(ctx, args)
+}
+
+// stringArg 读取字符串参数
+func stringArg(args map[string]interface{}, name string, required bool) (string, error) {
+	value, ok := args[name]
+	if !ok || value == nil {
+		if required {
+			return "", fmt.Errorf("缺少参数: %s", name)
+		}
+		return "", nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("参数%s应为字符串", name)
+	}
+	return s, nil
+}
+
+func init() {
+	Register(Calculator{})
+	Register(CurrentTime{})
+	Register(HistorySearch{})
+}